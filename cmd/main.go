@@ -2,12 +2,17 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/golang/glog"
 	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/robfig/cron/v3"
 
@@ -32,13 +37,13 @@ func SyncJobsInDataBase() error {
 		return err
 	}
 	for _, job := range jobs {
-		glog.Info(job)
+		glog.Infof("[Job#%d][%s][Status: %d]Syncing", job.ID, job.Name, job.Status)
 		if job.Status != 0 || job.DeletedAt != nil {
 			// 筛选一下
 			continue
 		}
 		// 在任务调度器中创建新任务
-		jobRun := util.JobRun{Job: job}
+		jobRun := util.JobRun{JobID: job.ID}
 		jobNewEntryID, err := config.Cron.AddJob(job.Cron, jobRun)
 		if err != nil {
 			return err
@@ -53,20 +58,38 @@ func SyncJobsInDataBase() error {
 }
 
 func main() {
-	// 初始化日志库
+	// 初始化日志库及命令行参数
 	flag.Parse()
 	// Flush 守护进程间隔 30s 周期性刷新缓冲区中的日志
 	defer glog.Flush()
-	// 连接 sqlite3 数据库
-	var err error
-	config.DataBase, err = gorm.Open("sqlite3", "surveillance_guy.db")
+	// 加载配置文件、环境变量及命令行参数
+	err := config.LoadConfig()
+	if err != nil {
+		panic("failed to load config: " + err.Error())
+	}
+	fmt.Print("effective config:\n" + config.EffectiveConfig())
+	glog.Info("effective config:\n" + config.EffectiveConfig())
+	// 连接数据库
+	config.DataBase, err = gorm.Open(config.DataBaseDialect, config.DataBaseSource())
 	if err != nil {
 		panic("failed to connect database: " + err.Error())
 	}
 	defer config.DataBase.Close()
-	// 自动迁移模式， 保持更新到最新
-	// 仅创建表， 缺少列和索引， 不会改变现有列的类型或删除未使用的列以保护数据
-	config.DataBase.AutoMigrate(&model.Account{}, &model.Job{}, &model.Template{})
+	// migrate 子命令仅执行数据库迁移后退出
+	if flag.Arg(0) == "migrate" {
+		err = RunMigrateCommand(flag.Args()[1:])
+		if err != nil {
+			glog.Error(err.Error())
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	// 执行版本化迁移， 保持表结构更新到最新
+	err = PrepareSchema()
+	if err != nil {
+		panic("failed to migrate database: " + err.Error())
+	}
 	// 创建并开始 cron 调度定时任务
 	config.Cron = cron.New()
 	// 同步数据库中存在的定时任务
@@ -74,6 +97,11 @@ func main() {
 	if err != nil {
 		glog.Error(err.Error())
 	}
+	// 定期核对调度器与数据库中的任务, 修复其他途径修改数据库造成的不一致
+	err = util.StartJobReconciler()
+	if err != nil {
+		glog.Error(err.Error())
+	}
 	config.Cron.Start()
 	// 创建 gin 实例
 	engine := gin.Default()
@@ -101,6 +129,13 @@ func main() {
 		v1.DELETE("/job", handler.DeleteJob)
 		v1.PUT("/job", handler.UpdateJob)
 		v1.GET("/job", handler.GetAllAccounts)
+		v1.POST("/job/preview", handler.PreviewJobNotify)
+		v1.POST("/job/from-template", handler.AddJobFromTemplate)
+		// 任务执行记录查询
+		v1.GET("/job/:id/runs", handler.GetJobRunRecords)
+		v1.GET("/runs", handler.GetRunRecords)
+		// 任务值变动历史查询
+		v1.GET("/job/:id/changes", handler.GetJobValueChanges)
 		// 邮箱账号 CRUD
 		v1.POST("/account", handler.AddAccount)
 		v1.DELETE("/account", handler.DeleteAccount)
@@ -109,6 +144,23 @@ func main() {
 		// 功能测试接口
 		v1.GET("/test-pattern", handler.TestRegexPattern)
 		v1.POST("/test-email", handler.TestEmail)
+		// 通知渠道 CRUD
+		v1.POST("/channel", handler.AddChannel)
+		v1.DELETE("/channel", handler.DeleteChannel)
+		v1.PUT("/channel", handler.UpdateChannel)
+		v1.GET("/channel", handler.GetAllChannels)
+		v1.POST("/test-channel", handler.TestChannel)
+		// 接收人分组 CRUD
+		v1.POST("/recipient-group", handler.AddRecipientGroup)
+		v1.DELETE("/recipient-group", handler.DeleteRecipientGroup)
+		v1.PUT("/recipient-group", handler.UpdateRecipientGroup)
+		v1.GET("/recipient-group", handler.GetAllRecipientGroups)
+		// 登录会话 CRUD
+		v1.POST("/session", handler.AddSession)
+		v1.DELETE("/session", handler.DeleteSession)
+		v1.PUT("/session", handler.UpdateSession)
+		v1.GET("/session", handler.GetAllSessions)
+		v1.POST("/test-session", handler.TestSession)
 		// 任务模板 CRUD
 		v1.POST("/template", handler.AddTemplate)
 		v1.DELETE("/template", handler.DeleteTemplate)
@@ -119,6 +171,5 @@ func main() {
 	docs.SwaggerInfo.BasePath = "/api/v1"
 	engine.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	port := "8848"
-	engine.Run(":" + port)
+	engine.Run(":" + strconv.Itoa(config.Port))
 }
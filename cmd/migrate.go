@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/golang/glog"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+	"surveillance-guy/util"
+)
+
+// RunMigrateCommand
+// 执行 migrate 子命令: up 执行所有未执行的迁移, down [steps] 回滚最近的迁移(默认 1 个), status 输出迁移状态
+func RunMigrateCommand(args []string) error {
+	command := model.MigrateStatus
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch command {
+	case model.MigrateUp:
+		count, err := util.MigrateUp(config.DataBase)
+		fmt.Printf("applied %d migrations\n", count)
+		if err != nil {
+			return err
+		}
+	case model.MigrateDown:
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf(config.MigrateStepsInvalid, args[1])
+			}
+		}
+		count, err := util.MigrateDown(config.DataBase, steps)
+		fmt.Printf("rolled back %d migrations\n", count)
+		if err != nil {
+			return err
+		}
+	case model.MigrateStatus:
+		states, err := util.GetMigrationStates(config.DataBase)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			appliedAt := "pending"
+			if state.Applied {
+				appliedAt = state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-48s %s\n", state.Version, state.Name, appliedAt)
+		}
+	default:
+		return fmt.Errorf(config.MigrateCommandInvalid, command)
+	}
+	return nil
+}
+
+// PrepareSchema
+// 启动时检查数据库迁移, 开启自动迁移时执行所有未执行的迁移, 否则存在未执行的迁移时拒绝启动
+func PrepareSchema() error {
+	if config.DataBaseAutoMigrate {
+		count, err := util.MigrateUp(config.DataBase)
+		if count > 0 {
+			glog.Infof("applied %d migrations", count)
+		}
+		return err
+	}
+	states, err := util.GetMigrationStates(config.DataBase)
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, state := range states {
+		if !state.Applied {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf(config.SchemaMigrationsPending, pending)
+	}
+	return nil
+}
@@ -5,6 +5,12 @@ var (
 	SMTPInfoNotFound    = "Can't found target SMTP information for the email-suffix"
 	TailFileReopen      = "tail file close reopen, filename: %s\n"
 	PatternTypeNotFound = "Pattern-type `%s` is not found"
+	QueryParamInvalid   = "Query parameter `%s` is invalid"
+	TargetNotMatch      = "Can't match target"
+	CSSPatternInvalid   = "CSS pattern `%s` is invalid"
+	IDListInvalid       = "ID list `%s` is invalid"
+	EmailListInvalid    = "Email `%s` is invalid"
+	RecordNotFound      = "record not found"
 )
 
 var (
@@ -41,6 +47,10 @@ var (
 	HtmlCodeGetFailZH          = "获取页面 html 源码失败"
 	RegexPatternInvalidZH      = "抓取规则无效"
 	RegexPatternValidZH        = "正则表达式测试成功， 匹配到内容"
+	PatternTypeInvalidZH       = "抓取规则类型无效"
+	QueryParamInvalidZH        = "查询参数无效"
+	RunRecordListGetFailZH     = "任务执行记录获取失败"
+	RunRecordListGetSuccessZH  = "任务执行记录获取成功"
 	TemplateAddFailZH          = "任务模板创建失败"
 	TemplateAddSuccessZH       = "任务模板创建成功"
 	TemplateDeleteFailZH       = "任务模板删除失败"
@@ -50,3 +60,189 @@ var (
 	TemplateListGetFailZH      = "获取任务模板列表失败"
 	TemplateListGetSuccessZH   = "获取任务模板列表成功"
 )
+
+var (
+	ValueChangeListGetFailZH    = "变动历史获取失败"
+	ValueChangeListGetSuccessZH = "变动历史获取成功"
+)
+
+var (
+	ChannelTypeNotFound       = "Channel-type `%s` is not found"
+	ChannelNotifyFail         = "Notify by channel #%d failed: %s"
+	ChannelRespondError       = "Channel responded with error: %s"
+	ChannelRespondStatusError = "Channel responded with status %d"
+)
+
+var (
+	ChannelAddFailZH        = "通知渠道添加失败"
+	ChannelAddSuccessZH     = "通知渠道添加成功"
+	ChannelDeleteFailZH     = "通知渠道删除失败"
+	ChannelDeleteSuccessZH  = "通知渠道删除成功"
+	ChannelUpdateFailZH     = "通知渠道更新失败"
+	ChannelUpdateSuccessZH  = "通知渠道更新成功"
+	ChannelListGetFailZH    = "通知渠道列表获取失败"
+	ChannelListGetSuccessZH = "通知渠道列表获取成功"
+	ChannelTypeInvalidZH    = "通知渠道类型无效"
+	ChannelNotFoundZH       = "数据库中未找到该通知渠道"
+	ChannelTestFailZH       = "通知渠道测试消息发送失败"
+	ChannelTestSuccessZH    = "通知渠道测试消息发送成功"
+	ChannelIDListInvalidZH  = "通知渠道 ID 列表无效"
+	ChannelSecretSaveFailZH = "通知渠道凭据加密失败, 请检查是否配置了密钥"
+)
+
+var (
+	RecipientGroupAddFailZH        = "接收人分组添加失败"
+	RecipientGroupAddSuccessZH     = "接收人分组添加成功"
+	RecipientGroupDeleteFailZH     = "接收人分组删除失败"
+	RecipientGroupDeleteSuccessZH  = "接收人分组删除成功"
+	RecipientGroupUpdateFailZH     = "接收人分组更新失败"
+	RecipientGroupUpdateSuccessZH  = "接收人分组更新成功"
+	RecipientGroupListGetFailZH    = "接收人分组列表获取失败"
+	RecipientGroupListGetSuccessZH = "接收人分组列表获取成功"
+	RecipientListInvalidZH         = "收件人、抄送或密送邮箱列表无效"
+	RecipientGroupIDListInvalidZH  = "接收人分组 ID 列表无效"
+)
+
+var (
+	NotifyTemplateInvalidZH = "通知标题或内容模板无效"
+	NotifyPreviewFailZH     = "通知模板预览失败"
+	NotifyPreviewSuccessZH  = "通知模板预览成功"
+)
+
+var (
+	TemplateNotExistZH        = "该任务模板不存在， 请核验"
+	TemplateCronInvalidZH     = "任务模板的定时配置无效"
+	TemplateSyncJobsFailZH    = "任务模板已更新, 但同步关联任务失败"
+	TemplateSyncJobsSuccessZH = "任务模板更新成功, 已同步关联任务"
+)
+
+var (
+	ConfigFileParseError        = "Failed to parse config file `%s`: %w"
+	ConfigEnvInvalid            = "Environment variable `%s` is invalid: %w"
+	ConfigValueInvalid          = "Config `%s` is invalid: %v"
+	AuthenticateSecretInvalid   = "Authenticate secret `%s` is invalid, expected user:password"
+	AuthenticateSecretPublished = "the password of `%s` is a published default, choose another one"
+)
+
+var (
+	MigrationFail           = "Migration %d (%s) failed: %w"
+	MigrationValueTooLong   = "Column %s.%s has %d values longer than %d characters, shorten them before rolling back"
+	MigrateCommandInvalid   = "Unknown migrate command `%s`, expected up, down [steps] or status"
+	MigrateStepsInvalid     = "Migrate down steps `%s` is invalid"
+	SchemaMigrationsPending = "Database has %d pending migrations, run `migrate up` first"
+)
+
+var (
+	FetchModeNotFound         = "Fetch mode `%s` not found"
+	BrowserEndpointEmpty      = "Browser endpoint is not configured"
+	BrowserTargetInvalid      = "Browser endpoint returned no debugger url"
+	BrowserRenderTimeout      = "Timed out rendering `%s` in browser: %w"
+	BrowserNavigateFail       = "Browser failed to navigate to `%s`: %s"
+	BrowserProtocolError      = "Browser protocol error on %s: %s"
+	BrowserEvaluateFail       = "Browser failed to evaluate script: %s"
+	BrowserRespondStatusError = "Browser endpoint responded with status %d"
+)
+
+var (
+	FetchModeInvalidZH  = "页面抓取方式无效"
+	JobRequestInvalidZH = "任务的请求配置无效"
+)
+
+var (
+	JobMethodInvalid          = "Request method `%s` is invalid"
+	JobHeadersInvalid         = "Request headers must be a JSON object of strings: %v"
+	JobQueryInvalid           = "Request query must be a JSON object of strings: %v"
+	JobCookiesInvalid         = "Request cookies `%s` are invalid, expected a=1; b=2"
+	JobMaxRedirectsInvalid    = "Max redirects `%d` is invalid"
+	TooManyRedirects          = "Stopped after %d redirects"
+	BrowserRequestUnsupported = "Browser fetch mode only supports GET requests without body"
+)
+
+var (
+	SecretKeyEmpty             = "Secret key is not configured"
+	SecretDecryptFail          = "Failed to decrypt secret, the secret key may have changed"
+	SessionStepsInvalid        = "Session steps must be a non-empty JSON array: %v"
+	SessionStepUrlEmpty        = "Session step %d has no url"
+	SessionExtractNameEmpty    = "Session step %d has an extract without name"
+	SessionExtractFail         = "Session step %d failed to extract `%s`: %w"
+	SessionStepFail            = "Session step %d responded with status %d"
+	SessionExpireStatusInvalid = "Session expire status `%s` is invalid"
+	SessionLoginFail           = "Failed to log in session `%s`: %w"
+	SessionStillExpired        = "Session is still expired after logging in again"
+)
+
+var (
+	SessionAddSuccessZH       = "登录会话添加成功"
+	SessionAddFailZH          = "登录会话添加失败"
+	SessionDeleteSuccessZH    = "登录会话删除成功"
+	SessionDeleteFailZH       = "登录会话删除失败"
+	SessionUpdateSuccessZH    = "登录会话更新成功"
+	SessionUpdateFailZH       = "登录会话更新失败"
+	SessionListGetSuccessZH   = "登录会话列表获取成功"
+	SessionListGetFailZH      = "登录会话列表获取失败"
+	SessionInvalidZH          = "登录会话配置无效"
+	SessionPasswordSaveFailZH = "登录会话密码加密失败, 请检查是否配置了密钥"
+	SessionNotFoundZH         = "数据库中未找到该登录会话"
+	SessionTestSuccessZH      = "登录会话测试成功"
+	SessionTestFailZH         = "登录会话测试失败"
+)
+
+var (
+	ProxyInvalid        = "Proxy `%s` is invalid, expected http://, https:// or socks5:// url"
+	CABundleInvalid     = "CA bundle `%s` contains no certificates"
+	OutboundSchemeDeny  = "Scheme `%s` is not allowed"
+	OutboundHostDeny    = "Host `%s` is not allowed by the outbound policy"
+	OutboundAddressDeny = "Address `%s` of host `%s` is not allowed by the outbound policy"
+)
+
+var OutboundDenyZH = "目标地址不被出站访问策略允许"
+
+var FetchStatusError = "Target page responded with status %d"
+
+var (
+	TriggerRulesInvalid      = "Trigger rules must be a JSON array of rules: %v"
+	TriggerOpInvalid         = "Trigger operator `%s` is invalid"
+	TriggerValueInvalid      = "Trigger rule `%s` value `%s` is invalid: %v"
+	TriggerNameDuplicate     = "Trigger rule name `%s` is duplicated"
+	TriggerExpressionInvalid = "Trigger expression is invalid at `%s`"
+	TriggerRuleUndefined     = "Trigger expression references undefined rule `%s`"
+	NumberParseFail          = "Can't parse a number from `%s`"
+)
+
+var JobTriggerInvalidZH = "任务的触发规则无效"
+
+var (
+	NormalizeStepsInvalid = "Normalizers must be a JSON array of steps: %v"
+	NormalizeTypeInvalid  = "Normalize step %d type `%s` is invalid"
+	NormalizePatternEmpty = "Normalize step %d (%s) requires a pattern"
+	NormalizeStepFail     = "Normalize step %d (%s) failed: %w"
+)
+
+var (
+	JobNormalizersInvalidZH = "任务的规范化步骤无效"
+	NormalizeFailZH         = "抓取结果规范化失败"
+)
+
+var (
+	MonitorModeNotFound = "Monitor mode `%s` not found"
+	RegionInvalid       = "Region selector `%s` is invalid: %v"
+	IgnoreLinesInvalid  = "Ignore lines must be a JSON array of regular expressions: %v"
+)
+
+var (
+	HashBrowserUnsupported  = "The hash monitor mode only supports the http fetch mode"
+	MaxDownloadSizeInvalid  = "Max download size `%d` is invalid"
+	MaxDownloadSizeExceeded = "Response body exceeds the max download size of %d bytes"
+)
+
+var JobMonitorInvalidZH = "任务的监控方式配置无效"
+
+var OverlapPolicyNotFound = "Overlap policy `%s` not found"
+
+var JobOverlapPolicyInvalidZH = "任务的重叠执行策略无效"
+
+var (
+	HostThrottled    = "Requests to `%s` are throttled, the next slot is in %s"
+	RobotsDisallowed = "`%s` is disallowed by robots.txt"
+	RobotsFetchFail  = "Fetching robots.txt of `%s` failed with status %d"
+)
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/jinzhu/gorm"
 	"github.com/robfig/cron/v3"
 )
@@ -9,32 +11,136 @@ var DataBase *gorm.DB
 
 var Cron *cron.Cron
 
+var (
+	Port                = 8848
+	DataBaseDialect     = DialectSqlite
+	DataBaseDSN         = ""
+	DataBasePath        = "surveillance_guy.db"
+	DataBaseAutoMigrate = true
+)
+
+var (
+	DialectSqlite   = "sqlite3"
+	DialectMySQL    = "mysql"
+	DialectPostgres = "postgres"
+)
+
 // UserAgent 在线可以查询 https://it-tool.711lxsky.cn/user-agent-parser
 var (
 	UserAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
 	Timeout   = 30
 )
 
-var EmailSubject = "【更新提示】 %s 有变动啦！"
+var DefaultMaxRedirects = 10
+
+// Retries 抓取失败后的重试配置, 等待时间单位为秒
+var (
+	Retries         = 2
+	RetryBackoff    = 1
+	RetryMaxBackoff = 60
+)
+
+// MaxDownloadSize hash 监控方式下允许下载的最大字节数, 默认 100 MiB
+var MaxDownloadSize int64 = 100 << 20
+
+// BrowserEndpoint 无头浏览器的 Chrome DevTools Protocol HTTP 地址, 如 chromium --headless --remote-debugging-port=9222
+var (
+	BrowserEndpoint     = "http://127.0.0.1:9222"
+	BrowserNetworkIdle  = 500 * time.Millisecond // 无进行中的请求持续该时长即视为网络空闲
+	BrowserPollInterval = 100 * time.Millisecond // 等待选择器出现时的轮询间隔
+)
+
+// EmailSubject 默认通知标题模板, 任务未设置标题模板时使用
+var EmailSubject = "【更新提示】 {{.Name}} 有变动啦！"
 
+// TextDiffContent text 监控方式下任务未设置通知内容时使用的默认内容, 展示页面文本的差异
+var TextDiffContent = "<p>{{.Name}} 的页面文本有变动:</p><pre>{{.Diff}}</pre><p>{{.URL}}</p>"
+
+// HashChangeContent hash 监控方式下任务未设置通知内容时使用的默认内容, 展示新旧摘要及大小
+var HashChangeContent = "<p>{{.Name}} 的文件有变动:</p><p>SHA-256: {{.OldHash}} → {{.NewHash}}</p><p>大小: {{.OldSize}} → {{.NewSize}} 字节</p><p>{{.URL}}</p>"
+
+// DefaultFailureThreshold 任务未设置连续失败告警阈值时使用的默认值
+var DefaultFailureThreshold = 3
+
+// JobBrokenSubject 任务连续失败及恢复时的通知标题及内容, 依次填入任务名称、连续失败次数、URL、失败类型、失败原因及时间
+var (
+	JobBrokenSubject    = "【任务异常】 %s 已连续失败 %d 次"
+	JobBrokenContent    = "<p>任务 <b>%s</b> 已连续失败 %d 次, 请检查目标页面或抓取规则</p><p>URL: %s</p><p>失败类型: %s</p><p>失败原因: %s</p><p>时间: %s</p>"
+	JobRecoveredSubject = "【任务恢复】 %s 已恢复正常"
+	JobRecoveredContent = "<p>任务 <b>%s</b> 在连续失败 %d 次后已恢复正常</p><p>URL: %s</p><p>时间: %s</p>"
+)
+
+var (
+	SampleOldValue = "旧值示例"
+	SampleNewValue = "新值示例"
+)
+
+var (
+	TelegramApiUrl     = "https://api.telegram.org"
+	WebhookDefaultBody = `{"subject": {{json .Subject}}, "content": {{json .Content}}, "name": {{json .JobName}}, "url": {{json .JobUrl}}, "oldValue": {{json .OldValue}}, "value": {{json .NewValue}}}`
+	ChannelTestSubject = "【测试】 SurveillanceGuy 通知渠道测试"
+	ChannelTestContent = "这是一条测试消息, 收到即说明通知渠道配置正确"
+)
+
+// 不内置默认账号, 开启 BasicAuth 时须在配置中指定
 var (
 	BasicAuth           = false
-	AuthenticateSecrets = map[string]string{
-		"sur-guy": "711lxsky.",
-	}
+	AuthenticateSecrets = map[string]string{}
+	// PublishedPasswords 曾内置或出现在示例配置中的密码, 开启 BasicAuth 时拒绝使用
+	PublishedPasswords = []string{"711lxsky.", "change-me"}
+)
+
+// 抓取页面时的代理、TLS 校验及出站访问策略, 详见 NetworkConfig
+var (
+	Proxy               = ""
+	InsecureSkipVerify  = false
+	CABundle            = ""
+	AllowHosts          []string
+	DenyHosts           []string
+	DenyPrivateNetworks = true
 )
 
+// ReconcileInterval 核对调度器与数据库中任务的间隔, 单位为秒, 0 表示不核对
+var ReconcileInterval = 300
+
+// 任务执行的并发限制及随机延迟, 详见 SchedulerConfig
+var (
+	MaxConcurrentRuns = 10
+	MaxRunsPerHost    = 2
+	StartJitter       = 0
+)
+
+// 访问同一主机的频率限制及 robots.txt 遵守策略, 详见 PolitenessConfig
+var (
+	HostRate        = 0.0
+	HostBurst       = 1
+	MinHostDelay    = 0
+	MaxThrottleWait = 60
+	RespectRobots   = false
+	RobotsCacheTTL  = 3600
+)
+
+// RobotsUserAgent 匹配 robots.txt 中 User-agent 分组时使用的名称, 没有对应分组时使用 * 分组
+var RobotsUserAgent = "surveillance-guy"
+
+// SecretKey 加密存储登录会话密码及 Cookie 的密钥, 为空时无法保存带密码的登录会话
+var SecretKey = ""
+
 var LogFilePath = "/data/surveillance-guy.INFO"
 
 var (
 	ResponseMessage     = "massage"
 	ResponseErrorReason = "reason"
 	ResponseData        = "data"
+	ResponseTotal       = "total"
+	ResponseSteps       = "steps"
 )
 
 var PasswordEncoded = "********"
 
 var (
-	IDEqual    = "id = ?"
-	EmailEqual = "email = ?"
+	IDEqual         = "id = ?"
+	EmailEqual      = "email = ?"
+	JobIDEqual      = "job_id = ?"
+	TemplateIDEqual = "template_id = ?"
 )
@@ -0,0 +1,313 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+	"surveillance-guy/util"
+)
+
+// AddChannel
+// @Summary 新建通知渠道
+// @Description 创建一个新的通知渠道 (webhook / slack / telegram / dingtalk / wecom / feishu) 并将其添加至数据库
+// @Tags 通知渠道管理
+// @Accept json
+// @Produce json
+// @Param channel body model.Channel true "通知渠道详情"
+// @Success 200 {object} gin.H "通知渠道添加成功"
+// @Failure 500 {object} gin.H "JSON解析失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "通知渠道类型无效" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "通知渠道凭据加密失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "通知渠道添加失败" "reason" string "错误原因"
+// @Router /channel [post]
+func AddChannel(context *gin.Context) {
+	var channel model.Channel
+	if err := context.BindJSON(&channel); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JSONParseErrorZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	if _, err := util.NewNotifier(channel); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.ChannelTypeInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	channel, err := util.SealChannel(channel)
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.ChannelSecretSaveFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	err = config.DataBase.Create(&channel).Error
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.ChannelAddFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.ChannelAddSuccessZH,
+		})
+}
+
+// DeleteChannel
+// @Summary 删除通知渠道
+// @Description 根据提供的通知渠道 ID 从数据库中软删除通知渠道
+// @Tags 通知渠道管理
+// @Accept json
+// @Produce json
+// @Param channel body model.Channel true "通知渠道ID"
+// @Success 200 {object} gin.H "通知渠道删除成功"
+// @Failure 500 {object} gin.H "JSON解析失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "通知渠道删除失败" "reason" string "错误原因"
+// @Router /channel [delete]
+func DeleteChannel(context *gin.Context) {
+	var channel model.Channel
+	if err := context.BindJSON(&channel); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JSONParseErrorZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	// 软删除
+	timeNow := time.Now()
+	err := config.DataBase.Model(&channel).Updates(
+		model.Channel{
+			Name: channel.Name + timeNow.String(),
+			Model: gorm.Model{
+				DeletedAt: &timeNow},
+		}).Error
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.ChannelDeleteFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.ChannelDeleteSuccessZH,
+		})
+}
+
+// UpdateChannel
+// @Summary 更新通知渠道
+// @Description 根据提供的通知渠道 ID 更新数据库中的通知渠道信息, token、secret、headers 及机器人 url 为掩码时保留原值
+// @Tags 通知渠道管理
+// @Accept json
+// @Produce json
+// @Param channel body model.Channel true "通知渠道详情"
+// @Success 200 {object} gin.H "通知渠道更新成功"
+// @Failure 500 {object} gin.H "JSON解析失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "通知渠道类型无效" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "通知渠道凭据加密失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "通知渠道更新失败" "reason" string "错误原因"
+// @Router /channel [put]
+func UpdateChannel(context *gin.Context) {
+	var (
+		channel model.Channel
+		err     error
+	)
+	if err = context.BindJSON(&channel); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JSONParseErrorZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	if _, err = util.NewNotifier(channel); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.ChannelTypeInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	// 列表接口返回的是掩码, 未修改时沿用数据库中的原值, 加密后保存
+	channel, err = restoreMaskedChannel(channel)
+	if err == nil {
+		channel, err = util.SealChannel(channel)
+	}
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.ChannelSecretSaveFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	err = config.DataBase.Where(config.IDEqual, channel.ID).Save(&channel).Error
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.ChannelUpdateFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.ChannelUpdateSuccessZH,
+		})
+}
+
+// GetAllChannels
+// @Summary 获取所有通知渠道列表
+// @Description 查询并返回数据库中所有通知渠道的信息，敏感信息如 token、secret、headers 及机器人 url 会被隐藏
+// @Tags 通知渠道管理
+// @Accept */*
+// @Produce json
+// @Success 200 {object} gin.H "通知渠道列表获取成功" "data" []Channel
+// @Failure 500 {object} gin.H "通知渠道列表获取失败" "reason" string "错误原因"
+// @Router /channel [get]
+func GetAllChannels(context *gin.Context) {
+	var channels []model.Channel
+	err := config.DataBase.Find(&channels).Error
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.ChannelListGetFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	// 擦除 token、secret、headers 及带有 access token 的地址
+	for i := range channels {
+		channels[i] = util.MaskChannel(channels[i])
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.ChannelListGetSuccessZH,
+			config.ResponseData:    channels,
+		})
+}
+
+// TestChannel
+// @Summary 测试通知渠道
+// @Description 通过指定的通知渠道发送一条测试消息, 仅携带 ID 时使用数据库中的配置
+// @Tags 通知渠道管理
+// @Accept json
+// @Produce json
+// @Param channel body model.Channel true "通知渠道详情"
+// @Success 200 {object} gin.H "通知渠道测试消息发送成功"
+// @Failure 500 {object} gin.H "JSON解析失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "数据库中未找到该通知渠道" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "通知渠道类型无效" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "通知渠道测试消息发送失败" "reason" string "错误原因"
+// @Router /test-channel [post]
+func TestChannel(context *gin.Context) {
+	var (
+		channel model.Channel
+		err     error
+	)
+	if err = context.BindJSON(&channel); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JSONParseErrorZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	// 请求没有携带渠道类型， 去数据库去拿, 携带的凭据为掩码时使用数据库中的原值
+	if channel.Type == "" {
+		err = config.DataBase.Where(config.IDEqual, channel.ID).First(&channel).Error
+		if err == nil {
+			channel, err = util.OpenChannel(channel)
+		}
+	} else {
+		channel, err = restoreMaskedChannel(channel)
+	}
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.ChannelNotFoundZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	notifier, err := util.NewNotifier(channel)
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.ChannelTypeInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	err = notifier.Notify(util.NotifyMessage{
+		Subject: config.ChannelTestSubject,
+		Content: config.ChannelTestContent,
+	})
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.ChannelTestFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.ChannelTestSuccessZH,
+		})
+}
+
+// restoreMaskedChannel
+// 请求中的凭据字段为掩码时, 从数据库读取并解密原配置, 沿用其中的值
+func restoreMaskedChannel(channel model.Channel) (model.Channel, error) {
+	if channel.Token != config.PasswordEncoded && channel.Secret != config.PasswordEncoded &&
+		channel.Headers != config.PasswordEncoded && channel.Url != config.PasswordEncoded {
+		return channel, nil
+	}
+	var stored model.Channel
+	err := config.DataBase.Where(config.IDEqual, channel.ID).First(&stored).Error
+	if err != nil {
+		return channel, err
+	}
+	stored, err = util.OpenChannel(stored)
+	if err != nil {
+		return channel, err
+	}
+	return util.RestoreMaskedChannel(channel, stored), nil
+}
@@ -40,6 +40,200 @@ func ADDJob(context *gin.Context) {
 			})
 		return
 	}
+	if !validateJob(context, job) {
+		return
+	}
+	createJob(context, job)
+}
+
+// AddJobFromTemplate
+// @Summary 根据任务模板创建定时任务
+// @Description 以指定的任务模板为基础创建定时任务, 定时配置、抓取规则及通知模板取自任务模板, 名称、URL 及接收人等其余字段取自请求, 任务会关联该模板以便后续同步
+// @Tags 定时任务管理
+// @Accept json
+// @Produce json
+// @Param job body model.Job true "定时任务详情, 需携带 templateId"
+// @Success 200 {object} gin.H "定时任务创建成功"
+// @Failure 500 {object} gin.H "JSON解析失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "该任务模板不存在，请核验" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "该任务已经存在，请勿重复添加"
+// @Failure 500 {object} gin.H "任务添加失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "在调度器中创建定时任务失败" "reason" string "错误原因"
+// @Router /job/from-template [post]
+func AddJobFromTemplate(context *gin.Context) {
+	var (
+		job      model.Job
+		template model.Template
+	)
+	if err := context.BindJSON(&job); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JSONParseErrorZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	if err := config.DataBase.First(&template, job.TemplateID).Error; err != nil || job.TemplateID == 0 {
+		reason := config.RecordNotFound
+		if err != nil {
+			reason = err.Error()
+		}
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.TemplateNotExistZH,
+				config.ResponseErrorReason: reason,
+			})
+		return
+	}
+	util.ApplyTemplate(&job, template)
+	if !validateJob(context, job) {
+		return
+	}
+	createJob(context, job)
+}
+
+// validateJob
+// 校验任务的抓取规则类型、通知渠道、接收人及通知模板, 无效时中止请求并返回 false
+func validateJob(context *gin.Context, job model.Job) bool {
+	// 校验抓取规则类型
+	if _, err := util.GetExtractor(job.PatternType); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.PatternTypeInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return false
+	}
+	// 校验页面抓取方式
+	if err := util.ValidateFetchMode(job.FetchMode); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.FetchModeInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return false
+	}
+	// 校验请求方法、请求头、查询参数、Cookie 及代理
+	if err := util.ValidateJobRequest(job); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JobRequestInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return false
+	}
+	// 校验监控方式
+	if err := util.ValidateMonitorMode(job); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JobMonitorInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return false
+	}
+	// 校验规范化步骤
+	if err := util.ValidateNormalizeSteps(job.Normalizers); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JobNormalizersInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return false
+	}
+	// 校验触发规则
+	if err := util.ValidateTriggers(job); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JobTriggerInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return false
+	}
+	// 校验重叠执行策略
+	if err := util.ValidateOverlapPolicy(job.OverlapPolicy); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JobOverlapPolicyInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return false
+	}
+	// 校验目标地址是否被出站访问策略允许
+	if err := util.CheckOutboundUrl(job.Url); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.OutboundDenyZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return false
+	}
+	// 校验登录会话是否存在
+	if job.SessionID != 0 {
+		if err := config.DataBase.Where(config.IDEqual, job.SessionID).First(&model.Session{}).Error; err != nil {
+			context.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				gin.H{
+					config.ResponseMessage:     config.SessionNotFoundZH,
+					config.ResponseErrorReason: err.Error(),
+				})
+			return false
+		}
+	}
+	// 校验通知渠道 ID 列表
+	if _, err := util.ParseIDList(job.ChannelIDs); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.ChannelIDListInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return false
+	}
+	// 校验收件人、抄送、密送及接收人分组
+	if err := util.ValidateEmailLists(job.Recipients, job.CC, job.BCC); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.RecipientListInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return false
+	}
+	if _, err := util.ParseIDList(job.RecipientGroupIDs); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.RecipientGroupIDListInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return false
+	}
+	// 校验通知标题及内容模板
+	if err := util.ValidateNotifyTemplates(job); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.NotifyTemplateInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return false
+	}
+	return true
+}
+
+// createJob
+// 将新任务写入数据库并注册到 cron 调度器
+func createJob(context *gin.Context, job model.Job) {
 	// 判断任务是否已经存在
 	if util.JobIsExistInDataBaseByName(job.Name) {
 		context.AbortWithStatusJSON(
@@ -49,6 +243,9 @@ func ADDJob(context *gin.Context) {
 			})
 		return
 	}
+	// 任务 ID 及 EntryID 由数据库和调度器分配, 请求中的值不可信, 不充分相信用户
+	job.ID = 0
+	job.EntryID = 0
 	// 没有该任务， 写入数据库
 	err := config.DataBase.Create(&job).Error
 	if err != nil {
@@ -60,13 +257,13 @@ func ADDJob(context *gin.Context) {
 			})
 		return
 	}
-	glog.Info(job)
-	// 添加定时任务到 cron 调度器
-	jobRun := util.JobRun{Job: job}
-	jobEntryID, err := config.Cron.AddJob(job.Cron, jobRun)
+	// 任务中含有请求头、Cookie 及代理等凭据, 日志中只记录 ID 及名称
+	glog.Infof("[Job#%d][%s]Created", job.ID, job.Name)
+	// 添加定时任务到 cron 调度器, 并将 EntryID 写回数据库
+	err = util.ScheduleJob(&job)
 	if err != nil {
 		// 因为添加任务失败， 所以需要重新恢复数据， 即 revert
-		err = config.DataBase.Unscoped().Delete(&job).Error
+		config.DataBase.Unscoped().Delete(&job)
 		context.AbortWithStatusJSON(
 			http.StatusInternalServerError,
 			gin.H{
@@ -75,7 +272,6 @@ func ADDJob(context *gin.Context) {
 			})
 		return
 	}
-	job.EntryID = int(jobEntryID)
 	util.PrintAllJobs()
 	context.JSON(
 		http.StatusOK,
@@ -176,6 +372,9 @@ func UpdateJob(context *gin.Context) {
 			})
 		return
 	}
+	if !validateJob(context, job) {
+		return
+	}
 	// 判断任务是否已经存在
 	if !util.JobIsExistInDataBaseByJobID(job.ID) {
 		context.AbortWithStatusJSON(
@@ -198,11 +397,22 @@ func UpdateJob(context *gin.Context) {
 		return
 	}
 	job.EntryID = jobEntryID
+	// 连续失败次数、上次下载的大小及触发规则的基准值由执行结果维护, 同样不采用请求中的值
+	var storedJob model.Job
+	if err = config.DataBase.Select("failure_streak, failure_alerted, content_size, trigger_value").First(&storedJob, job.ID).Error; err == nil {
+		job.FailureStreak = storedJob.FailureStreak
+		job.FailureAlerted = storedJob.FailureAlerted
+		job.ContentSize = storedJob.ContentSize
+		job.TriggerValue = storedJob.TriggerValue
+	}
+	// 抓取规则等可能已修改, 清空校验头使下次执行完整抓取页面
+	job.ETag = ""
+	job.LastModified = ""
 	glog.Info(job.EntryID, job.Status)
 	// 在调度器中更新对应任务
 	config.Cron.Remove(cron.EntryID(jobEntryID))
 	if job.Status == 0 {
-		jobRun := util.JobRun{Job: job}
+		jobRun := util.JobRun{JobID: job.ID}
 		newJobEntryID, err := config.Cron.AddJob(job.Cron, jobRun)
 		if err != nil {
 			context.AbortWithStatusJSON(
@@ -265,3 +475,76 @@ func GetAllJobs(context *gin.Context) {
 			config.ResponseData:    jobs,
 		})
 }
+
+// PreviewJobNotify
+// @Summary 预览任务通知
+// @Description 使用任务最近的变动历史 (没有时使用示例值) 渲染通知标题及内容模板, 携带 ID 时以数据库中的任务为基础, 请求中非空的 subject、content 会覆盖原模板
+// @Description 可用变量: {{.Name}} {{.URL}} {{.OldValue}} {{.NewValue}} {{.Diff}} {{.RunTime}} {{.Added}} {{.Removed}} {{.Job}}, 可用函数: br、lines、join
+// @Tags 定时任务管理
+// @Accept json
+// @Produce json
+// @Param job body model.Job true "定时任务详情"
+// @Success 200 {object} gin.H "通知模板预览成功" "data" util.NotifyMessage
+// @Failure 500 {object} gin.H "JSON解析失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "通知模板预览失败" "reason" string "错误原因"
+// @Router /job/preview [post]
+func PreviewJobNotify(context *gin.Context) {
+	var job model.Job
+	if err := context.BindJSON(&job); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JSONParseErrorZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	data := util.SampleNotifyData(job)
+	if job.ID != 0 {
+		var storedJob model.Job
+		if err := config.DataBase.First(&storedJob, job.ID).Error; err != nil {
+			context.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				gin.H{
+					config.ResponseMessage:     config.JobNotExistZH,
+					config.ResponseErrorReason: err.Error(),
+				})
+			return
+		}
+		if job.Subject != "" {
+			storedJob.Subject = job.Subject
+		}
+		if job.Content != "" {
+			storedJob.Content = job.Content
+		}
+		job = storedJob
+		data = util.SampleNotifyData(job)
+		// 以最近两次变动作为示例
+		var changes []model.ValueChange
+		config.DataBase.Where(config.JobIDEqual, job.ID).Order("detected_at desc, id desc").Limit(2).Find(&changes)
+		if len(changes) > 0 {
+			var oldValue string
+			if len(changes) > 1 {
+				oldValue = changes[1].Value
+			}
+			added, removed := util.DiffTargets(util.SplitTargets(oldValue), util.SplitTargets(changes[0].Value))
+			data = util.NewNotifyData(job, oldValue, changes[0].Value, added, removed, changes[0].DetectedAt)
+		}
+	}
+	message, err := util.BuildNotifyMessage(job, data)
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.NotifyPreviewFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.NotifyPreviewSuccessZH,
+			config.ResponseData:    message,
+		})
+}
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+	"surveillance-guy/util"
+)
+
+// AddRecipientGroup
+// @Summary 新建接收人分组
+// @Description 创建一个新的接收人分组 (收件人、抄送、密送) 并将其添加至数据库, 任务可通过分组 ID 引用
+// @Tags 接收人分组管理
+// @Accept json
+// @Produce json
+// @Param group body model.RecipientGroup true "接收人分组详情"
+// @Success 200 {object} gin.H "接收人分组添加成功"
+// @Failure 500 {object} gin.H "JSON解析失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "收件人、抄送或密送邮箱列表无效" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "接收人分组添加失败" "reason" string "错误原因"
+// @Router /recipient-group [post]
+func AddRecipientGroup(context *gin.Context) {
+	var group model.RecipientGroup
+	if err := context.BindJSON(&group); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JSONParseErrorZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	if err := util.ValidateEmailLists(group.Recipients, group.CC, group.BCC); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.RecipientListInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	err := config.DataBase.Create(&group).Error
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.RecipientGroupAddFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.RecipientGroupAddSuccessZH,
+		})
+}
+
+// DeleteRecipientGroup
+// @Summary 删除接收人分组
+// @Description 根据提供的接收人分组 ID 从数据库中软删除接收人分组
+// @Tags 接收人分组管理
+// @Accept json
+// @Produce json
+// @Param group body model.RecipientGroup true "接收人分组ID"
+// @Success 200 {object} gin.H "接收人分组删除成功"
+// @Failure 500 {object} gin.H "JSON解析失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "接收人分组删除失败" "reason" string "错误原因"
+// @Router /recipient-group [delete]
+func DeleteRecipientGroup(context *gin.Context) {
+	var group model.RecipientGroup
+	if err := context.BindJSON(&group); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JSONParseErrorZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	// 软删除
+	timeNow := time.Now()
+	err := config.DataBase.Model(&group).Updates(
+		model.RecipientGroup{
+			Name: group.Name + timeNow.String(),
+			Model: gorm.Model{
+				DeletedAt: &timeNow},
+		}).Error
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.RecipientGroupDeleteFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.RecipientGroupDeleteSuccessZH,
+		})
+}
+
+// UpdateRecipientGroup
+// @Summary 更新接收人分组
+// @Description 根据提供的接收人分组 ID 更新数据库中的接收人分组信息
+// @Tags 接收人分组管理
+// @Accept json
+// @Produce json
+// @Param group body model.RecipientGroup true "接收人分组详情"
+// @Success 200 {object} gin.H "接收人分组更新成功"
+// @Failure 500 {object} gin.H "JSON解析失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "收件人、抄送或密送邮箱列表无效" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "接收人分组更新失败" "reason" string "错误原因"
+// @Router /recipient-group [put]
+func UpdateRecipientGroup(context *gin.Context) {
+	var (
+		group model.RecipientGroup
+		err   error
+	)
+	if err = context.BindJSON(&group); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JSONParseErrorZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	if err = util.ValidateEmailLists(group.Recipients, group.CC, group.BCC); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.RecipientListInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	err = config.DataBase.Where(config.IDEqual, group.ID).Save(&group).Error
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.RecipientGroupUpdateFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.RecipientGroupUpdateSuccessZH,
+		})
+}
+
+// GetAllRecipientGroups
+// @Summary 获取所有接收人分组列表
+// @Description 查询并返回数据库中所有接收人分组的信息
+// @Tags 接收人分组管理
+// @Accept */*
+// @Produce json
+// @Success 200 {object} gin.H "接收人分组列表获取成功" "data" []RecipientGroup
+// @Failure 500 {object} gin.H "接收人分组列表获取失败" "reason" string "错误原因"
+// @Router /recipient-group [get]
+func GetAllRecipientGroups(context *gin.Context) {
+	var groups []model.RecipientGroup
+	err := config.DataBase.Find(&groups).Error
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.RecipientGroupListGetFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.RecipientGroupListGetSuccessZH,
+			config.ResponseData:    groups,
+		})
+}
@@ -1,8 +1,8 @@
 package handler
 
 import (
-	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 
@@ -13,30 +13,50 @@ import (
 
 // TestRegexPattern
 // @Summary 测试正则表达式匹配
-// @Description 根据提供的URL、正则表达式和类型对页面HTML源码进行匹配测试
+// @Description 根据提供的URL、抓取规则和类型对页面HTML源码进行匹配测试
 // @Tags 正则测试
 // @Accept */*
 // @Produce json
 // @Param id query string true "任务ID"
-// @Param url query string true "页面URL"
-// @Param pattern query string true "正则表达式"
-// @Param type query string false "匹配类型，默认为're'（正则）" default(re)
-// @Success 200 {object} gin.H "正则表达式测试成功，匹配到内容" "data" string
+// @Param url query string true "页面URL，与任务页面不同源时不携带任务的请求头、Cookie 及登录会话"
+// @Param pattern query string true "抓取规则"
+// @Param type query string false "匹配类型，re（正则）、css（CSS 选择器）、xpath 或 jsonpath，默认沿用任务的类型，否则为're'（正则）"
+// @Param multi query bool false "是否提取所有匹配，默认沿用任务的配置"
+// @Param mode query string false "页面抓取方式，http 或 browser（经无头浏览器渲染），默认沿用任务的配置"
+// @Param monitor query string false "监控方式，value（按抓取规则提取）、text（页面可读文本）或 hash（内容摘要），默认沿用任务的配置"
+// @Param region query string false "text 方式下监控区域的 CSS 选择器，默认沿用任务的配置"
+// @Param normalizers query string false "规范化步骤的 JSON 数组，默认沿用任务的配置"
+// @Success 200 {object} gin.H "正则表达式测试成功，匹配到规范化后的内容" "data" string 或 []string "steps" []util.NormalizeTrace "每一步规范化之后的值"
 // @Failure 500 {object} gin.H "获取页面 html 源码失败" "reason" string "错误原因"
 // @Failure 500 {object} gin.H "抓取规则无效" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "抓取结果规范化失败" "reason" string "错误原因" "steps" []util.NormalizeTrace "出错前每一步规范化之后的值"
 // @Router /test-email [get]测试正则表达式效果
 func TestRegexPattern(context *gin.Context) {
 	var (
-		testRes string
+		testRes interface{}
 		job     model.Job
 		err     error
 	)
 	jobID := context.Query(model.ID)
 	url := context.Query(model.URL)
 	pattern := context.Query(model.Pattern)
-	patternType := context.DefaultQuery(model.Type, model.RE)
 	config.DataBase.Where(config.IDEqual, jobID).First(&job)
-	html, err := util.GetHtmlByUrl(url)
+	// 未指定抓取规则类型时沿用任务自身的类型, 默认正则
+	patternType := context.DefaultQuery(model.Type, job.PatternType)
+	// 按任务的抓取方式获取页面, 可通过 mode 临时指定
+	fetchJob := job
+	fetchJob.Url = url
+	fetchJob.FetchMode = context.DefaultQuery(model.Mode, job.FetchMode)
+	// 监控方式及监控区域同样可以临时指定, hash 方式下抓取时即计算摘要, 测试时总是完整下载
+	fetchJob.MonitorMode = context.DefaultQuery(model.Monitor, job.MonitorMode)
+	fetchJob.Region = context.DefaultQuery(model.Region, job.Region)
+	fetchJob.TrustValidators = false
+	fetchJob.NoConditionalGet = true
+	// 测试页面与任务页面不同源时不携带任务的请求头、Cookie 及登录会话等凭据, 避免泄露给其他站点
+	if !util.SameOrigin(url, job.Url) {
+		fetchJob = util.WithoutCredentials(fetchJob)
+	}
+	page, err := util.FetchJobPage(fetchJob)
 	if err != nil {
 		context.AbortWithStatusJSON(
 			http.StatusInternalServerError,
@@ -46,13 +66,20 @@ func TestRegexPattern(context *gin.Context) {
 			})
 		return
 	}
-	// 根据 pattern 对 html 源码进行匹配
-	switch patternType {
-	case model.RE:
-		testRes, err = util.MatchTargetByRegexPattern(html, pattern)
-	default:
-		err = fmt.Errorf(config.PatternTypeNotFound, patternType)
+	// 根据 pattern 对 html 源码进行匹配, 与定时任务共用同一组提取器
+	// 未指定是否多值匹配时沿用任务自身的配置
+	multiMatch, parseErr := strconv.ParseBool(context.DefaultQuery(model.Multi, strconv.FormatBool(job.MultiMatch)))
+	if parseErr != nil {
+		multiMatch = job.MultiMatch
+	}
+	// text 及 hash 方式下整页作为一个值
+	fetchJob.Pattern = pattern
+	fetchJob.PatternType = patternType
+	if fetchJob.MonitorMode == model.MonitorText || fetchJob.MonitorMode == model.MonitorHash {
+		multiMatch = false
 	}
+	fetchJob.MultiMatch = multiMatch
+	targets, err := util.ExtractJobTargets(fetchJob, page)
 	if err != nil {
 		context.AbortWithStatusJSON(
 			http.StatusInternalServerError,
@@ -62,6 +89,26 @@ func TestRegexPattern(context *gin.Context) {
 			})
 		return
 	}
+	// 按规范化步骤处理匹配结果并返回每一步之后的值, 可通过 normalizers 临时指定, hash 方式的摘要无需规范化
+	normalizers := context.DefaultQuery(model.Normalizers, job.Normalizers)
+	if fetchJob.MonitorMode == model.MonitorHash {
+		normalizers = ""
+	}
+	targets, traces, err := util.NormalizeTargets(targets, normalizers, job.NumberLocale)
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.NormalizeFailZH,
+				config.ResponseErrorReason: err.Error(),
+				config.ResponseSteps:       traces,
+			})
+		return
+	}
+	testRes = targets
+	if !multiMatch {
+		testRes = targets[0]
+	}
 	// 抓取规则有效， 更新数据库， 将状态设置为有效, 即测试通过
 	if job.ID != 0 {
 		config.DataBase.Model(&job).Update(model.PatternStatus, model.RegexPatternValid)
@@ -71,5 +118,6 @@ func TestRegexPattern(context *gin.Context) {
 		gin.H{
 			config.ResponseMessage: config.RegexPatternValidZH,
 			config.ResponseData:    testRes,
+			config.ResponseSteps:   traces,
 		})
 }
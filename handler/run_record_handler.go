@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// GetJobRunRecords
+// @Summary 获取指定任务的执行记录
+// @Description 分页查询指定任务的执行记录, 支持按执行结果、失败类型和时间范围筛选
+// @Tags 执行记录
+// @Accept */*
+// @Produce json
+// @Param id path int true "任务ID"
+// @Param page query int false "页码, 默认为 1" default(1)
+// @Param pageSize query int false "每页条数, 默认为 20, 最大 100" default(20)
+// @Param status query string false "执行结果, success、failed、not_modified 或 deferred"
+// @Param failureType query string false "失败类型, dns / connect / tls / timeout / http_4xx / http_5xx / no_match / robots / other"
+// @Param start query string false "开始时间, RFC3339 格式"
+// @Param end query string false "结束时间, RFC3339 格式"
+// @Success 200 {object} gin.H "任务执行记录获取成功" "data" []RunRecord
+// @Failure 400 {object} gin.H "查询参数无效" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "任务执行记录获取失败" "reason" string "错误原因"
+// @Router /job/{id}/runs [get]
+func GetJobRunRecords(context *gin.Context) {
+	jobID, err := strconv.ParseUint(context.Param(model.ID), 10, 64)
+	if err != nil {
+		abortQueryParamInvalid(context, model.ID)
+		return
+	}
+	queryRunRecords(context, config.DataBase.Where(config.JobIDEqual, jobID))
+}
+
+// GetRunRecords
+// @Summary 获取所有任务的执行记录
+// @Description 分页查询所有任务的执行记录, 支持按执行结果、失败类型和时间范围筛选
+// @Tags 执行记录
+// @Accept */*
+// @Produce json
+// @Param page query int false "页码, 默认为 1" default(1)
+// @Param pageSize query int false "每页条数, 默认为 20, 最大 100" default(20)
+// @Param status query string false "执行结果, success、failed、not_modified 或 deferred"
+// @Param failureType query string false "失败类型, dns / connect / tls / timeout / http_4xx / http_5xx / no_match / robots / other"
+// @Param start query string false "开始时间, RFC3339 格式"
+// @Param end query string false "结束时间, RFC3339 格式"
+// @Success 200 {object} gin.H "任务执行记录获取成功" "data" []RunRecord
+// @Failure 400 {object} gin.H "查询参数无效" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "任务执行记录获取失败" "reason" string "错误原因"
+// @Router /runs [get]
+func GetRunRecords(context *gin.Context) {
+	queryRunRecords(context, config.DataBase)
+}
+
+// queryRunRecords
+// 根据请求中的分页及筛选参数查询执行记录并返回
+func queryRunRecords(context *gin.Context, db *gorm.DB) {
+	var (
+		records []model.RunRecord
+		total   int
+	)
+	// 分页参数
+	page, err := strconv.Atoi(context.DefaultQuery(model.Page, "1"))
+	if err != nil || page < 1 {
+		abortQueryParamInvalid(context, model.Page)
+		return
+	}
+	pageSize, err := strconv.Atoi(context.DefaultQuery(model.PageSize, strconv.Itoa(model.DefaultPageSize)))
+	if err != nil || pageSize < 1 || pageSize > model.MaxPageSize {
+		abortQueryParamInvalid(context, model.PageSize)
+		return
+	}
+	// 筛选条件
+	if status := context.Query(model.Status); status != "" {
+		db = db.Where("status = ?", status)
+	}
+	if failureType := context.Query(model.FailureType); failureType != "" {
+		db = db.Where("failure_type = ?", failureType)
+	}
+	if start := context.Query(model.Start); start != "" {
+		startTime, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			abortQueryParamInvalid(context, model.Start)
+			return
+		}
+		db = db.Where("start_time >= ?", startTime)
+	}
+	if end := context.Query(model.End); end != "" {
+		endTime, err := time.Parse(time.RFC3339, end)
+		if err != nil {
+			abortQueryParamInvalid(context, model.End)
+			return
+		}
+		db = db.Where("start_time <= ?", endTime)
+	}
+	err = db.Model(&model.RunRecord{}).Count(&total).Error
+	if err == nil {
+		err = db.Order("start_time desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&records).Error
+	}
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.RunRecordListGetFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.RunRecordListGetSuccessZH,
+			config.ResponseData:    records,
+			config.ResponseTotal:   total,
+		})
+}
+
+// abortQueryParamInvalid
+// 查询参数无效时中止请求
+func abortQueryParamInvalid(context *gin.Context, param string) {
+	context.AbortWithStatusJSON(
+		http.StatusBadRequest,
+		gin.H{
+			config.ResponseMessage:     config.QueryParamInvalidZH,
+			config.ResponseErrorReason: fmt.Sprintf(config.QueryParamInvalid, param),
+		})
+}
@@ -0,0 +1,289 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+	"surveillance-guy/util"
+)
+
+// AddSession
+// @Summary 新建登录会话
+// @Description 创建一个新的登录会话, 密码加密后存储, 任务通过 sessionId 引用后在抓取前自动登录
+// @Tags 登录会话管理
+// @Accept json
+// @Produce json
+// @Param session body model.Session true "登录会话详情"
+// @Success 200 {object} gin.H "登录会话添加成功"
+// @Failure 500 {object} gin.H "JSON解析失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "登录会话配置无效" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "登录会话密码加密失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "登录会话添加失败" "reason" string "错误原因"
+// @Router /session [post]
+func AddSession(context *gin.Context) {
+	var session model.Session
+	if err := context.BindJSON(&session); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JSONParseErrorZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	if !validateSession(context, session) {
+		return
+	}
+	encrypted, err := util.EncryptSecret(session.Password)
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.SessionPasswordSaveFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	session.Password = encrypted
+	err = config.DataBase.Create(&session).Error
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.SessionAddFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.SessionAddSuccessZH,
+		})
+}
+
+// DeleteSession
+// @Summary 删除登录会话
+// @Description 根据提供的登录会话 ID 从数据库中软删除登录会话
+// @Tags 登录会话管理
+// @Accept json
+// @Produce json
+// @Param session body model.Session true "登录会话ID"
+// @Success 200 {object} gin.H "登录会话删除成功"
+// @Failure 500 {object} gin.H "JSON解析失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "登录会话删除失败" "reason" string "错误原因"
+// @Router /session [delete]
+func DeleteSession(context *gin.Context) {
+	var session model.Session
+	if err := context.BindJSON(&session); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JSONParseErrorZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	// 软删除
+	timeNow := time.Now()
+	err := config.DataBase.Model(&session).Updates(
+		model.Session{
+			Name: session.Name + timeNow.String(),
+			Model: gorm.Model{
+				DeletedAt: &timeNow},
+		}).Error
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.SessionDeleteFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.SessionDeleteSuccessZH,
+		})
+}
+
+// UpdateSession
+// @Summary 更新登录会话
+// @Description 根据提供的登录会话 ID 更新其信息, 密码为掩码时保留原值, 更新后清除已保存的 Cookie, 下次抓取时重新登录
+// @Tags 登录会话管理
+// @Accept json
+// @Produce json
+// @Param session body model.Session true "登录会话详情"
+// @Success 200 {object} gin.H "登录会话更新成功"
+// @Failure 500 {object} gin.H "JSON解析失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "登录会话配置无效" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "登录会话密码加密失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "登录会话更新失败" "reason" string "错误原因"
+// @Router /session [put]
+func UpdateSession(context *gin.Context) {
+	var (
+		session model.Session
+		err     error
+	)
+	if err = context.BindJSON(&session); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JSONParseErrorZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	if !validateSession(context, session) {
+		return
+	}
+	// 列表接口返回的是掩码, 未修改时沿用数据库中的原值
+	if session.Password == config.PasswordEncoded {
+		var tmpSession model.Session
+		config.DataBase.Where(config.IDEqual, session.ID).First(&tmpSession)
+		session.Password = tmpSession.Password
+	} else {
+		session.Password, err = util.EncryptSecret(session.Password)
+		if err != nil {
+			context.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				gin.H{
+					config.ResponseMessage:     config.SessionPasswordSaveFailZH,
+					config.ResponseErrorReason: err.Error(),
+				})
+			return
+		}
+	}
+	// Cookies 不随请求传入, Save 时被清空, 使用新配置重新登录
+	err = config.DataBase.Where(config.IDEqual, session.ID).Save(&session).Error
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.SessionUpdateFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.SessionUpdateSuccessZH,
+		})
+}
+
+// GetAllSessions
+// @Summary 获取所有登录会话列表
+// @Description 查询并返回数据库中所有登录会话的信息，密码会被隐藏
+// @Tags 登录会话管理
+// @Accept */*
+// @Produce json
+// @Success 200 {object} gin.H "登录会话列表获取成功" "data" []Session
+// @Failure 500 {object} gin.H "登录会话列表获取失败" "reason" string "错误原因"
+// @Router /session [get]
+func GetAllSessions(context *gin.Context) {
+	var sessions []model.Session
+	err := config.DataBase.Find(&sessions).Error
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.SessionListGetFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	// 擦除密码字段
+	n := len(sessions)
+	for i := 0; i < n; i++ {
+		if sessions[i].Password != "" {
+			sessions[i].Password = config.PasswordEncoded
+		}
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.SessionListGetSuccessZH,
+			config.ResponseData:    sessions,
+		})
+}
+
+// TestSession
+// @Summary 测试登录会话
+// @Description 立即执行指定登录会话的登录步骤并保存得到的 Cookie, 返回 Cookie 名称列表
+// @Tags 登录会话管理
+// @Accept json
+// @Produce json
+// @Param session body model.Session true "登录会话ID"
+// @Success 200 {object} gin.H "登录会话测试成功" "data" []string
+// @Failure 500 {object} gin.H "JSON解析失败" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "数据库中未找到该登录会话" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "登录会话测试失败" "reason" string "错误原因"
+// @Router /test-session [post]
+func TestSession(context *gin.Context) {
+	var (
+		session model.Session
+		err     error
+	)
+	if err = context.BindJSON(&session); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.JSONParseErrorZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	err = config.DataBase.Where(config.IDEqual, session.ID).First(&session).Error
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.SessionNotFoundZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	cookies, err := util.LoginSession(&session)
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.SessionTestFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	// 仅返回 Cookie 名称, 避免泄露会话内容
+	names := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		names = append(names, cookie.Name)
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.SessionTestSuccessZH,
+			config.ResponseData:    names,
+		})
+}
+
+// validateSession
+// 校验登录会话的步骤及失效判定配置, 不通过时中止请求并返回 false
+func validateSession(context *gin.Context, session model.Session) bool {
+	if err := util.ValidateSession(session); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.SessionInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return false
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -9,6 +10,7 @@ import (
 
 	"surveillance-guy/config"
 	"surveillance-guy/model"
+	"surveillance-guy/util"
 )
 
 // AddTemplate
@@ -33,6 +35,36 @@ func AddTemplate(context *gin.Context) {
 			})
 		return
 	}
+	// 校验抓取规则类型
+	if _, err := util.GetExtractor(template.PatternType); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.PatternTypeInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	// 校验通知标题及内容模板
+	if err := util.ValidateNotifyTemplates(model.Job{Name: template.Name, Subject: template.Subject, Content: template.Content}); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.NotifyTemplateInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	// 校验定时配置
+	if err := util.ValidateTemplateCron(template); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.TemplateCronInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
 	err := config.DataBase.Create(&template).Error
 	if err != nil {
 		context.AbortWithStatusJSON(
@@ -98,11 +130,12 @@ func DeleteTemplate(context *gin.Context) {
 
 // UpdateTemplate
 // @Summary 更新任务模板
-// @Description 根据提供的任务模板ID更新其信息
+// @Description 根据提供的任务模板ID更新其信息, sync 为 true 时将修改同步到所有关联的任务并重新调度
 // @Tags 任务模板管理
 // @Accept json
 // @Produce json
 // @Param template body model.Template true "任务模板详情"
+// @Param sync query bool false "是否同步关联的任务" default(false)
 // @Success 200 {object} gin.H "任务模板更新成功"
 // @Failure 500 {object} gin.H "JSON解析失败" "reason" string "错误原因"
 // @Failure 500 {object} gin.H "任务模板更新失败" "reason" string "错误原因"
@@ -121,6 +154,36 @@ func UpdateTemplate(context *gin.Context) {
 			})
 		return
 	}
+	// 校验抓取规则类型
+	if _, err := util.GetExtractor(template.PatternType); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.PatternTypeInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	// 校验通知标题及内容模板
+	if err := util.ValidateNotifyTemplates(model.Job{Name: template.Name, Subject: template.Subject, Content: template.Content}); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.NotifyTemplateInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	// 校验定时配置
+	if err := util.ValidateTemplateCron(template); err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.TemplateCronInvalidZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
 	err = config.DataBase.Where(config.IDEqual, template.ID).Save(&template).Error
 	if err != nil {
 		context.AbortWithStatusJSON(
@@ -131,6 +194,27 @@ func UpdateTemplate(context *gin.Context) {
 			})
 		return
 	}
+	// 按需将模板的修改同步到所有关联的任务
+	if sync, _ := strconv.ParseBool(context.Query(model.Sync)); sync {
+		syncedCount, err := util.SyncJobsFromTemplate(template)
+		if err != nil {
+			context.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				gin.H{
+					config.ResponseMessage:     config.TemplateSyncJobsFailZH,
+					config.ResponseErrorReason: err.Error(),
+					config.ResponseTotal:       syncedCount,
+				})
+			return
+		}
+		context.JSON(
+			http.StatusOK,
+			gin.H{
+				config.ResponseMessage: config.TemplateSyncJobsSuccessZH,
+				config.ResponseTotal:   syncedCount,
+			})
+		return
+	}
 	context.JSON(
 		http.StatusOK,
 		gin.H{
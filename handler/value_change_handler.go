@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+	"surveillance-guy/util"
+)
+
+// ValueChangeTimelineItem
+// 变动历史时间线条目, 附带与上一个值之间的差异
+type ValueChangeTimelineItem struct {
+	model.ValueChange
+	OldValue    string             `json:"oldValue"`    // 变动前的值
+	UnifiedDiff string             `json:"unifiedDiff"` // 按行比较的 unified 格式差异
+	InlineDiff  []util.DiffSegment `json:"inlineDiff"`  // 按字符比较的行内差异
+}
+
+// GetJobValueChanges
+// @Summary 获取指定任务的值变动历史
+// @Description 按检测时间倒序分页返回指定任务的值变动时间线, 并附带与上一个值之间的 unified 及行内差异
+// @Tags 变动历史
+// @Accept */*
+// @Produce json
+// @Param id path int true "任务ID"
+// @Param page query int false "页码, 默认为 1" default(1)
+// @Param pageSize query int false "每页条数, 默认为 20, 最大 100" default(20)
+// @Success 200 {object} gin.H "变动历史获取成功" "data" []ValueChangeTimelineItem
+// @Failure 400 {object} gin.H "查询参数无效" "reason" string "错误原因"
+// @Failure 500 {object} gin.H "变动历史获取失败" "reason" string "错误原因"
+// @Router /job/{id}/changes [get]
+func GetJobValueChanges(context *gin.Context) {
+	var (
+		changes []model.ValueChange
+		total   int
+	)
+	jobID, err := strconv.ParseUint(context.Param(model.ID), 10, 64)
+	if err != nil {
+		abortQueryParamInvalid(context, model.ID)
+		return
+	}
+	page, err := strconv.Atoi(context.DefaultQuery(model.Page, "1"))
+	if err != nil || page < 1 {
+		abortQueryParamInvalid(context, model.Page)
+		return
+	}
+	pageSize, err := strconv.Atoi(context.DefaultQuery(model.PageSize, strconv.Itoa(model.DefaultPageSize)))
+	if err != nil || pageSize < 1 || pageSize > model.MaxPageSize {
+		abortQueryParamInvalid(context, model.PageSize)
+		return
+	}
+	db := config.DataBase.Where(config.JobIDEqual, jobID)
+	err = db.Model(&model.ValueChange{}).Count(&total).Error
+	if err == nil {
+		// 多取一条, 作为本页最后一条的上一个值
+		err = db.Order("detected_at desc, id desc").Offset((page - 1) * pageSize).Limit(pageSize + 1).Find(&changes).Error
+	}
+	if err != nil {
+		context.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{
+				config.ResponseMessage:     config.ValueChangeListGetFailZH,
+				config.ResponseErrorReason: err.Error(),
+			})
+		return
+	}
+	timeline := []ValueChangeTimelineItem{}
+	for i := 0; i < len(changes) && i < pageSize; i++ {
+		var oldValue string
+		if i+1 < len(changes) {
+			oldValue = changes[i+1].Value
+		}
+		timeline = append(timeline, ValueChangeTimelineItem{
+			ValueChange: changes[i],
+			OldValue:    oldValue,
+			UnifiedDiff: util.UnifiedDiff(oldValue, changes[i].Value, 3),
+			InlineDiff:  util.InlineDiff(oldValue, changes[i].Value),
+		})
+	}
+	context.JSON(
+		http.StatusOK,
+		gin.H{
+			config.ResponseMessage: config.ValueChangeListGetSuccessZH,
+			config.ResponseData:    timeline,
+			config.ResponseTotal:   total,
+		})
+}
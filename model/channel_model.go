@@ -0,0 +1,33 @@
+package model
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+type Channel struct {
+	gorm.Model
+	Name    string `json:"name" gorm:"not null; unique"`    // 通知渠道名称
+	Type    string `json:"type" gorm:"type:varchar(32)"`    // 渠道类型, webhook / slack / telegram / dingtalk / wecom / feishu
+	Url     string `json:"url" gorm:"type:varchar(1024)"`   // webhook 地址, telegram 为 Bot API 地址, 为空时使用官方地址
+	Method  string `json:"method" gorm:"type:varchar(16)"`  // 通用 webhook 请求方法, 默认 POST
+	Headers string `json:"headers" gorm:"type:text"`        // 通用 webhook 请求头, JSON 对象, 如 {"Authorization": "Bearer xxx"}
+	Body    string `json:"body" gorm:"type:varchar(4096)"`  // 通用 webhook 请求体模板, text/template 语法
+	Token   string `json:"token" gorm:"type:varchar(512)"`  // telegram 机器人 token
+	ChatID  string `json:"chatId" gorm:"type:varchar(128)"` // telegram 会话 ID
+	Secret  string `json:"secret" gorm:"type:varchar(512)"` // 钉钉/飞书机器人加签密钥
+	Status  int    `json:"status" gorm:"type:int"`          // 渠道状态, 0: 启用, 1: 停用
+}
+
+var (
+	ChannelWebhook  = "webhook"
+	ChannelSlack    = "slack"
+	ChannelTelegram = "telegram"
+	ChannelDingTalk = "dingtalk"
+	ChannelWeCom    = "wecom"
+	ChannelFeishu   = "feishu"
+)
+
+var (
+	ChannelEnabled  = 0
+	ChannelDisabled = 1
+)
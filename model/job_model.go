@@ -6,16 +6,57 @@ import (
 
 type Job struct {
 	gorm.Model
-	Name          string `json:"name" gorm:"not null; unique"`       // 任务名称
-	Cron          string `json:"cron"`                               // 定时配置
-	EntryID       int    `json:"entryId" gorm:"not null"`            // cron 调度器的 job id
-	Url           string `json:"url" gorm:"type:varchar(512)"`       // 监控的 目标页面URL
-	OldValue      string `json:"oldValue" gorm:"type:varchar(2048)"` // 任务抓取目标的旧值
-	Pattern       string `json:"pattern" gorm:"type:varchar(1024)"`  // 目标页面URL的抓取规则
-	PatternStatus int    `json:"patternStatus" gorm:"type:int"`      // 抓取规则的测试状态, 0: 未测试, 1: 测试通过, 2: 测试失败 3: 测试中
-	Email         string `json:"email" gorm:"not null"`              // 邮件通知接收人
-	Content       string `json:"content" gorm:"type:varchar(2048)"`  // 邮件通知内容
-	Status        int    `json:"status" gorm:"type:int"`             // 工作运行状态, 0: 运行中, 1: 停止
+	Name              string `json:"name" gorm:"not null; unique"`               // 任务名称
+	Cron              string `json:"cron"`                                       // 定时配置
+	EntryID           int    `json:"entryId" gorm:"not null"`                    // cron 调度器的 job id
+	Url               string `json:"url" gorm:"type:varchar(512)"`               // 监控的 目标页面URL
+	OldValue          string `json:"oldValue" gorm:"type:text"`                  // 任务抓取目标的旧值
+	Pattern           string `json:"pattern" gorm:"type:varchar(1024)"`          // 目标页面URL的抓取规则
+	PatternType       string `json:"patternType" gorm:"type:varchar(32)"`        // 抓取规则类型, re: 正则, css: CSS 选择器, xpath: XPath, jsonpath: JSONPath, 为空时默认正则
+	MultiMatch        bool   `json:"multiMatch"`                                 // 是否提取所有匹配, 开启后按行存储所有结果并作为集合比较
+	PatternStatus     int    `json:"patternStatus" gorm:"type:int"`              // 抓取规则的测试状态, 0: 未测试, 1: 测试通过, 2: 测试失败 3: 测试中
+	Email             string `json:"email" gorm:"not null"`                      // 邮件通知接收人, 未指定发件账户及收件人时兼作发件账户和收件人
+	AccountID         uint   `json:"accountId" gorm:"index"`                     // 发件账户 ID, 关联 Account
+	Recipients        string `json:"recipients" gorm:"type:varchar(2048)"`       // 收件人邮箱列表, 以逗号分隔
+	CC                string `json:"cc" gorm:"type:varchar(2048)"`               // 抄送邮箱列表, 以逗号分隔
+	BCC               string `json:"bcc" gorm:"type:varchar(2048)"`              // 密送邮箱列表, 以逗号分隔
+	RecipientGroupIDs string `json:"recipientGroupIds" gorm:"type:varchar(256)"` // 接收人分组 ID 列表, 以逗号分隔
+	Subject           string `json:"subject" gorm:"type:varchar(512)"`           // 通知标题模板, 为空时使用默认标题
+	Content           string `json:"content" gorm:"type:varchar(2048)"`          // 邮件通知内容
+	ChannelIDs        string `json:"channelIds" gorm:"type:varchar(256)"`        // 额外的通知渠道 ID 列表, 以逗号分隔, 如 "1,3"
+	Status            int    `json:"status" gorm:"type:int"`                     // 工作运行状态, 0: 运行中, 1: 停止
+	TemplateID        uint   `json:"templateId" gorm:"index"`                    // 创建该任务所用的任务模板 ID, 0 表示未关联模板
+	FetchMode         string `json:"fetchMode" gorm:"type:varchar(32)"`          // 页面抓取方式, http: 直接请求, browser: 经无头浏览器渲染, 为空时默认 http
+	WaitSelector      string `json:"waitSelector" gorm:"type:varchar(512)"`      // browser 模式下等待出现的 CSS 选择器, 为空时等待网络空闲
+	Method            string `json:"method" gorm:"type:varchar(16)"`             // 请求方法, 为空时默认 GET
+	Headers           string `json:"headers" gorm:"type:varchar(2048)"`          // 请求头, JSON 对象, 如 {"Accept-Language": "zh-CN"}
+	Query             string `json:"query" gorm:"type:varchar(1024)"`            // 追加到 URL 的查询参数, JSON 对象, 如 {"q": "keyword"}
+	Body              string `json:"body" gorm:"type:varchar(4096)"`             // 请求体, 未指定 Content-Type 时按内容推断为 JSON 或表单
+	Cookies           string `json:"cookies" gorm:"type:varchar(2048)"`          // 请求携带的 Cookie, 格式同 Cookie 请求头, 如 "a=1; b=2"
+	NoRedirect        bool   `json:"noRedirect"`                                 // 是否不跟随重定向, 开启后直接使用重定向响应
+	MaxRedirects      int    `json:"maxRedirects" gorm:"type:int"`               // 最多跟随的重定向次数, 为 0 时默认 10
+	SessionID         uint   `json:"sessionId" gorm:"index"`                     // 登录会话 ID, 关联 Session, 抓取时携带会话的 Cookie, 0 表示无需登录
+	Proxy             string `json:"proxy" gorm:"type:varchar(1024)"`            // 任务代理, 多个以逗号分隔时轮流使用, 为空时使用全局代理, direct 表示直连
+	SkipTLSVerify     bool   `json:"skipTlsVerify"`                              // 是否跳过 TLS 证书校验, 仅对该任务生效
+	FailureThreshold  int    `json:"failureThreshold" gorm:"type:int"`           // 连续失败多少次后发送任务异常通知, 为 0 时默认 3, 小于 0 时不告警
+	FailureStreak     int    `json:"failureStreak" gorm:"type:int"`              // 当前连续失败次数, 由执行结果维护
+	FailureAlerted    bool   `json:"failureAlerted"`                             // 本轮连续失败是否已发送异常通知, 恢复后发送恢复通知并重置
+	TriggerRules      string `json:"triggerRules" gorm:"type:varchar(2048)"`     // 触发规则, TriggerRule 的 JSON 数组, 为空时值有变动即通知
+	TriggerExpression string `json:"triggerExpression" gorm:"type:varchar(512)"` // 组合触发规则的表达式, 支持 && || ! 及括号, 如 "low && !soldOut", 为空时须满足所有规则
+	NumberLocale      string `json:"numberLocale" gorm:"type:varchar(16)"`       // 解析数值时的区域设置, 如 en (1,234.56)、de (1.234,56), 为空时自动判断
+	Normalizers       string `json:"normalizers" gorm:"type:varchar(2048)"`      // 规范化步骤, NormalizeStep 的 JSON 数组, 抓取值按顺序处理后再存储和比较
+	MonitorMode       string `json:"monitorMode" gorm:"type:varchar(16)"`        // 监控方式, value: 按抓取规则提取值, text: 监控页面的可读文本, 为空时默认 value
+	Region            string `json:"region" gorm:"type:varchar(512)"`            // text 方式下只监控匹配该 CSS 选择器的区域, 为空时监控整个页面
+	IgnoreLines       string `json:"ignoreLines" gorm:"type:varchar(2048)"`      // text 方式下忽略的行, 正则表达式的 JSON 数组, 如 ["^更新于", "\\d+ 次浏览"]
+	MaxDownloadSize   int64  `json:"maxDownloadSize"`                            // hash 方式下允许下载的最大字节数, 为 0 时使用全局配置
+	TrustValidators   bool   `json:"trustValidators"`                            // hash 方式下响应的 ETag 或 Last-Modified 与上次相同时不下载内容, 直接视为未变动
+	ContentSize       int64  `json:"contentSize"`                                // hash 方式下上次下载的内容大小, 由执行结果维护
+	ETag              string `json:"etag" gorm:"column:etag;type:varchar(512)"`  // 上次响应的 ETag, 由执行结果维护
+	LastModified      string `json:"lastModified" gorm:"type:varchar(64)"`       // 上次响应的 Last-Modified, 由执行结果维护
+	NoConditionalGet  bool   `json:"noConditionalGet"`                           // 是否不发送条件请求, 服务端的 ETag 或 Last-Modified 不可靠时开启
+	OverlapPolicy     string `json:"overlapPolicy" gorm:"type:varchar(16)"`      // 上次执行尚未结束时的处理方式, skip: 跳过本次执行, delay: 等待上次结束后执行, 为空时默认 skip
+	IgnoreRobots      bool   `json:"ignoreRobots"`                               // 是否忽略目标站点的 robots.txt, 仅在全局开启遵守 robots.txt 时有意义
+	TriggerValue      string `json:"triggerValue" gorm:"type:text"`              // 触发规则比较的基准值, 即上次发送通知时的值, 由执行结果维护
 }
 
 var (
@@ -23,8 +64,33 @@ var (
 	URL           = "url"
 	Pattern       = "pattern"
 	Type          = "type"
+	Multi         = "multi"
+	Sync          = "sync"
 	RE            = "re"
+	CSS           = "css"
+	XPath         = "xpath"
+	JSONPath      = "jsonpath"
 	PatternStatus = "patten_status"
+	Mode          = "mode"
+	Normalizers   = "normalizers"
+	Monitor       = "monitor"
+	Region        = "region"
+)
+
+var (
+	FetchHTTP    = "http"
+	FetchBrowser = "browser"
+)
+
+var (
+	OverlapSkip  = "skip"
+	OverlapDelay = "delay"
+)
+
+var (
+	MonitorValue = "value"
+	MonitorText  = "text"
+	MonitorHash  = "hash"
 )
 
 var (
@@ -0,0 +1,21 @@
+package model
+
+// NormalizeStep
+// 规范化步骤, 在存储和比较前依次处理抓取到的值, 多值匹配时分别处理每个结果
+type NormalizeStep struct {
+	Type        string `json:"type"`        // 步骤类型, 见 Normalize* 变量
+	Pattern     string `json:"pattern"`     // regex_replace 及 remove_lines 使用的正则表达式
+	Replacement string `json:"replacement"` // regex_replace 的替换内容, 可用 $1 引用捕获组
+}
+
+var (
+	NormalizeTrim          = "trim"                // 去除首尾空白
+	NormalizeCollapseSpace = "collapse_whitespace" // 将连续空白合并为一个空格, 保留换行
+	NormalizeHtmlUnescape  = "html_unescape"       // 还原 HTML 实体, 如 &amp; -> &
+	NormalizeStripTags     = "strip_tags"          // 去除 HTML 标签, 仅保留文本
+	NormalizeLowercase     = "lowercase"           // 转换为小写
+	NormalizeRegexReplace  = "regex_replace"       // 按正则表达式替换
+	NormalizeRemoveLines   = "remove_lines"        // 删除匹配正则表达式的行
+	NormalizeExtractNumber = "extract_number"      // 只保留第一个数值, 按 Job.NumberLocale 解析
+	NormalizeRaw           = "raw"                 // 测试接口中表示规范化之前的原始值
+)
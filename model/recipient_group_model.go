@@ -0,0 +1,13 @@
+package model
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+type RecipientGroup struct {
+	gorm.Model
+	Name       string `json:"name" gorm:"not null; unique"`         // 接收人分组名称
+	Recipients string `json:"recipients" gorm:"type:varchar(2048)"` // 收件人邮箱列表, 以逗号分隔
+	CC         string `json:"cc" gorm:"type:varchar(2048)"`         // 抄送邮箱列表, 以逗号分隔
+	BCC        string `json:"bcc" gorm:"type:varchar(2048)"`        // 密送邮箱列表, 以逗号分隔
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type RunRecord struct {
+	gorm.Model
+	JobID         uint      `json:"jobId" gorm:"not null; index"`               // 所属任务 ID
+	StartTime     time.Time `json:"startTime" gorm:"index"`                     // 执行开始时间
+	EndTime       time.Time `json:"endTime"`                                    // 执行结束时间
+	FetchDuration int64     `json:"fetchDuration" gorm:"type:bigint"`           // 页面抓取耗时, 单位 ms
+	HTTPStatus    int       `json:"httpStatus" gorm:"type:int"`                 // 目标页面响应状态码
+	BytesFetched  int       `json:"bytesFetched" gorm:"type:int"`               // 抓取到的字节数
+	Value         string    `json:"value" gorm:"type:text"`                     // 本次抓取到的值
+	Changed       bool      `json:"changed"`                                    // 值是否发生变动
+	Status        string    `json:"status" gorm:"type:varchar(32); index"`      // 执行结果, running: 执行中, success: 成功, failed: 失败, not_modified: 页面未变动, 未下载内容, deferred: 限流等待过长, 推迟到下次执行
+	NotifyStatus  string    `json:"notifyStatus" gorm:"type:varchar(32)"`       // 通知结果, none: 未通知, sent: 已发送, failed: 发送失败, skipped: 有变动但未满足触发规则
+	Error         string    `json:"error" gorm:"type:varchar(2048)"`            // 失败原因, 超出 MaxErrorLength 时截断
+	FailureType   string    `json:"failureType" gorm:"type:varchar(32); index"` // 失败类型, dns / connect / tls / timeout / http_4xx / http_5xx / no_match / robots / other
+	Attempts      int       `json:"attempts" gorm:"type:int"`                   // 页面抓取尝试次数, 含重试
+}
+
+var (
+	RunStatusRunning     = "running"
+	RunStatusSuccess     = "success"
+	RunStatusFailed      = "failed"
+	RunStatusNotModified = "not_modified"
+	RunStatusDeferred    = "deferred"
+	NotifyStatusNone     = "none"
+	NotifyStatusSent     = "sent"
+	NotifyStatusFailed   = "failed"
+	NotifyStatusSkip     = "skipped"
+)
+
+var (
+	FailureDNS     = "dns"
+	FailureConnect = "connect"
+	FailureTLS     = "tls"
+	FailureTimeout = "timeout"
+	FailureHTTP4xx = "http_4xx"
+	FailureHTTP5xx = "http_5xx"
+	FailureNoMatch = "no_match"
+	FailureRobots  = "robots"
+	FailureOther   = "other"
+)
+
+var (
+	Page            = "page"
+	PageSize        = "pageSize"
+	Status          = "status"
+	FailureType     = "failureType"
+	Start           = "start"
+	End             = "end"
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+	MaxErrorLength  = 2048
+)
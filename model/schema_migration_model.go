@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// SchemaMigration
+// 已执行的数据库迁移记录, 每个版本一行
+type SchemaMigration struct {
+	Version   uint      `json:"version" gorm:"primary_key; auto_increment:false"` // 迁移版本号
+	Name      string    `json:"name" gorm:"type:varchar(256)"`                    // 迁移名称
+	AppliedAt time.Time `json:"appliedAt"`                                        // 执行时间
+}
+
+var (
+	MigrateUp     = "up"
+	MigrateDown   = "down"
+	MigrateStatus = "status"
+)
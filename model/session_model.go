@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type Session struct {
+	gorm.Model
+	Name         string     `json:"name" gorm:"not null; unique"`          // 会话名称, 可被多个任务共用
+	Steps        string     `json:"steps" gorm:"type:varchar(8192)"`       // 登录步骤, SessionStep 的 JSON 数组
+	Username     string     `json:"username" gorm:"type:varchar(256)"`     // 登录用户名, 步骤中以 {{.username}} 引用
+	Password     string     `json:"password" gorm:"type:varchar(1024)"`    // 登录密码, 加密存储, 步骤中以 {{.password}} 引用
+	Cookies      string     `json:"-" gorm:"type:varchar(8192)"`           // 登录后得到的 Cookie, 加密存储
+	ExpireMarker string     `json:"expireMarker" gorm:"type:varchar(512)"` // 会话失效标记, 页面匹配该正则时视为失效并重新登录
+	ExpireStatus string     `json:"expireStatus" gorm:"type:varchar(128)"` // 视为会话失效的响应状态码, 以逗号分隔, 如 "401,403"
+	LoggedInAt   *time.Time `json:"loggedInAt"`                            // 最近一次登录成功的时间
+}
+
+// SessionStep
+// 登录步骤中的一个请求, Url、Headers 及 Body 支持 text/template 语法引用用户名、密码及先前步骤提取的变量
+type SessionStep struct {
+	Method  string            `json:"method"`  // 请求方法, 为空时默认 GET
+	Url     string            `json:"url"`     // 请求地址
+	Headers map[string]string `json:"headers"` // 请求头
+	Body    string            `json:"body"`    // 请求体, 未指定 Content-Type 时按内容推断为 JSON 或表单, 如 "user={{urlquery .username}}"
+	Extract []SessionExtract  `json:"extract"` // 从响应中提取的变量, 如 CSRF token
+}
+
+// SessionExtract
+// 从登录步骤的响应中提取变量, 提取方式与任务的抓取规则一致
+type SessionExtract struct {
+	Name        string `json:"name"`        // 变量名, 后续步骤以 {{.name}} 引用
+	Pattern     string `json:"pattern"`     // 抓取规则
+	PatternType string `json:"patternType"` // 抓取规则类型, 同 Job.PatternType
+}
+
+var (
+	SessionUsername = "username"
+	SessionPassword = "password"
+)
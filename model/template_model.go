@@ -6,8 +6,11 @@ import (
 
 type Template struct {
 	gorm.Model
-	Name    string `json:"name" gorm:"not null; unique"`      // 模板名称
-	Corn    string `json:"cron"`                              // 定时配置
-	Pattern string `json:"pattern" gorm:"type:varchar(1024)"` // 抓取规则
-	Content string `json:"content" gorm:"type:varchar(2048)"` // 邮件内容
+	Name        string `json:"name" gorm:"not null; unique"`        // 模板名称
+	Cron        string `json:"cron"`                                // 定时配置
+	Pattern     string `json:"pattern" gorm:"type:varchar(1024)"`   // 抓取规则
+	PatternType string `json:"patternType" gorm:"type:varchar(32)"` // 抓取规则类型, 同 Job.PatternType
+	MultiMatch  bool   `json:"multiMatch"`                          // 是否提取所有匹配, 同 Job.MultiMatch
+	Subject     string `json:"subject" gorm:"type:varchar(512)"`    // 通知标题模板, 同 Job.Subject
+	Content     string `json:"content" gorm:"type:varchar(2048)"`   // 邮件内容
 }
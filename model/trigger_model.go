@@ -0,0 +1,26 @@
+package model
+
+// TriggerRule
+// 触发规则, 值变动时按规则判断是否发送通知
+// 数值比较类规则先从抓取值中解析出数值, Value 使用 . 作为小数点
+type TriggerRule struct {
+	Name  string `json:"name"`  // 规则名称, 供 Job.TriggerExpression 引用, 为空时按顺序命名为 r1、r2 ...
+	Op    string `json:"op"`    // 运算符, 见 Trigger* 变量
+	Value string `json:"value"` // 比较的值, 数值、百分比、文本或正则表达式
+}
+
+var (
+	TriggerLess         = "<"              // 新值小于 Value
+	TriggerLessEqual    = "<="             // 新值小于等于 Value
+	TriggerGreater      = ">"              // 新值大于 Value
+	TriggerGreaterEqual = ">="             // 新值大于等于 Value
+	TriggerEqual        = "=="             // 新值等于 Value
+	TriggerNotEqual     = "!="             // 新值不等于 Value
+	TriggerCrossBelow   = "crosses_below"  // 旧值不低于 Value 而新值低于 Value
+	TriggerCrossAbove   = "crosses_above"  // 旧值不高于 Value 而新值高于 Value
+	TriggerCross        = "crosses"        // 向任一方向穿过 Value
+	TriggerPercent      = "percent_change" // 相对旧值的变化幅度不低于 Value%, 如 10 或 -10 (仅下跌)、+10 (仅上涨)
+	TriggerContains     = "contains"       // 新值包含 Value
+	TriggerNotContains  = "not_contains"   // 新值不包含 Value
+	TriggerRegex        = "regex"          // 新值匹配正则表达式 Value
+)
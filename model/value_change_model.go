@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type ValueChange struct {
+	gorm.Model
+	JobID       uint      `json:"jobId" gorm:"not null; index"` // 所属任务 ID
+	Value       string    `json:"value" gorm:"type:text"`       // 变动后的值
+	Hash        string    `json:"hash" gorm:"type:varchar(64)"` // 值的 SHA-256 摘要
+	DetectedAt  time.Time `json:"detectedAt" gorm:"index"`      // 检测到变动的时间
+	RunRecordID uint      `json:"runRecordId" gorm:"index"`     // 检测到变动的执行记录 ID
+}
@@ -0,0 +1,98 @@
+package util
+
+import (
+	"fmt"
+	"html"
+	"time"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// TrackJobFailure
+// 按本次执行结果更新任务的连续失败次数
+// 连续失败达到阈值时发送一次任务异常通知, 已发送异常通知的任务再次成功时发送恢复通知
+func TrackJobFailure(jobID uint, record model.RunRecord) error {
+	// 推迟的执行既不算失败也不算恢复
+	if record.Status == model.RunStatusDeferred {
+		return nil
+	}
+	var job model.Job
+	err := config.DataBase.First(&job, jobID).Error
+	if err != nil {
+		return err
+	}
+	// 页面已抓取成功、仅通知失败的执行不算抓取失败
+	fetched := record.Status == model.RunStatusSuccess || record.Status == model.RunStatusNotModified ||
+		record.NotifyStatus == model.NotifyStatusFailed
+	if fetched {
+		if job.FailureStreak == 0 && !job.FailureAlerted {
+			return nil
+		}
+		// Update 会同时修改 job, 先行构建恢复通知
+		alerted := job.FailureAlerted
+		message := jobRecoveredMessage(job, record)
+		err = config.DataBase.Model(&job).Update("failure_streak", 0).Error
+		if err != nil || !alerted {
+			return err
+		}
+		// 恢复通知发送成功后才清除已告警标记, 失败时下次成功执行重新发送
+		err = NotifyJob(job, message)
+		if err != nil {
+			return err
+		}
+		return config.DataBase.Model(&job).Update("failure_alerted", false).Error
+	}
+	streak := job.FailureStreak + 1
+	threshold := JobFailureThreshold(job)
+	alert := threshold > 0 && streak >= threshold && !job.FailureAlerted
+	err = config.DataBase.Model(&job).Update("failure_streak", streak).Error
+	if err != nil || !alert {
+		return err
+	}
+	// 异常通知发送成功后才标记为已告警, 失败时下次失败执行重新发送
+	err = NotifyJob(job, jobBrokenMessage(job, streak, record))
+	if err != nil {
+		return err
+	}
+	return config.DataBase.Model(&job).Update("failure_alerted", true).Error
+}
+
+// JobFailureThreshold
+// 返回任务的连续失败告警阈值, 小于等于 0 表示不告警
+func JobFailureThreshold(job model.Job) int {
+	if job.FailureThreshold == 0 {
+		return config.DefaultFailureThreshold
+	}
+	if job.FailureThreshold < 0 {
+		return 0
+	}
+	return job.FailureThreshold
+}
+
+// jobBrokenMessage
+// 构建任务异常通知
+func jobBrokenMessage(job model.Job, streak int, record model.RunRecord) NotifyMessage {
+	return NotifyMessage{
+		Subject: fmt.Sprintf(config.JobBrokenSubject, job.Name, streak),
+		Content: fmt.Sprintf(config.JobBrokenContent, html.EscapeString(job.Name), streak, html.EscapeString(job.Url),
+			html.EscapeString(record.FailureType), html.EscapeString(record.Error), record.StartTime.Format(time.DateTime)),
+		JobName:  job.Name,
+		JobUrl:   job.Url,
+		OldValue: job.OldValue,
+	}
+}
+
+// jobRecoveredMessage
+// 构建任务恢复通知
+func jobRecoveredMessage(job model.Job, record model.RunRecord) NotifyMessage {
+	return NotifyMessage{
+		Subject: fmt.Sprintf(config.JobRecoveredSubject, job.Name),
+		Content: fmt.Sprintf(config.JobRecoveredContent, html.EscapeString(job.Name), job.FailureStreak,
+			html.EscapeString(job.Url), record.StartTime.Format(time.DateTime)),
+		JobName:  job.Name,
+		JobUrl:   job.Url,
+		OldValue: job.OldValue,
+		NewValue: record.Value,
+	}
+}
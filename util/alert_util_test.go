@@ -0,0 +1,64 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+func TestTrackJobFailure(t *testing.T) {
+	setTestDataBase(t)
+	brokenUrl, _ := newNotifyServer(t, http.StatusInternalServerError, "down")
+	hookUrl, received := newNotifyServer(t, http.StatusOK, "ok")
+	channel := model.Channel{Name: "hook", Type: model.ChannelWebhook, Url: brokenUrl}
+	config.DataBase.Create(&channel)
+	job := model.Job{Name: "price", Url: "https://example.com", ChannelIDs: fmt.Sprint(channel.ID), FailureThreshold: 2}
+	config.DataBase.Create(&job)
+
+	failed := model.RunRecord{Status: model.RunStatusFailed, FailureType: model.FailureTimeout}
+	notifyFailed := model.RunRecord{Status: model.RunStatusFailed, NotifyStatus: model.NotifyStatusFailed}
+	success := model.RunRecord{Status: model.RunStatusSuccess}
+	steps := []struct {
+		name         string
+		record       model.RunRecord
+		channelUrl   string
+		wantErr      bool
+		wantStreak   int
+		wantAlerted  bool
+		wantReceived bool
+	}{
+		{"first failure", failed, "", false, 1, false, false},
+		// 仅通知失败的执行不算抓取失败
+		{"notify failure", notifyFailed, "", false, 0, false, false},
+		{"failure", failed, "", false, 1, false, false},
+		// 达到阈值但异常通知发送失败, 不标记为已告警
+		{"alert fails", failed, "", true, 2, false, false},
+		{"alert retried", failed, hookUrl, false, 3, true, true},
+		{"alerted once per streak", failed, "", false, 4, true, false},
+		// 恢复通知发送失败时保留已告警标记, 下次成功执行重新发送
+		{"recovery fails", success, brokenUrl, true, 0, true, false},
+		{"recovery retried", success, hookUrl, false, 0, false, true},
+	}
+	for _, step := range steps {
+		if step.channelUrl != "" {
+			config.DataBase.Model(&channel).Update("url", step.channelUrl)
+		}
+		received.method = ""
+		err := TrackJobFailure(job.ID, step.record)
+		if (err != nil) != step.wantErr {
+			t.Errorf("%s: TrackJobFailure() error = %v, want error %v", step.name, err, step.wantErr)
+		}
+		var stored model.Job
+		config.DataBase.First(&stored, job.ID)
+		if stored.FailureStreak != step.wantStreak || stored.FailureAlerted != step.wantAlerted {
+			t.Errorf("%s: streak = %d, alerted = %v, want %d, %v", step.name,
+				stored.FailureStreak, stored.FailureAlerted, step.wantStreak, step.wantAlerted)
+		}
+		if (received.method != "") != step.wantReceived {
+			t.Errorf("%s: notification received = %v, want %v", step.name, received.method != "", step.wantReceived)
+		}
+	}
+}
@@ -0,0 +1,471 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"surveillance-guy/config"
+)
+
+// cdpMessage
+// Chrome DevTools Protocol 消息, 带 ID 的为命令响应, 带 Method 的为事件
+type cdpMessage struct {
+	ID     int             `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// cdpTarget
+// 通过 /json/new 创建的浏览器标签页
+type cdpTarget struct {
+	ID                   string `json:"id"`
+	WebSocketDebuggerUrl string `json:"webSocketDebuggerUrl"`
+}
+
+// cdpSession
+// 与单个标签页的调试会话, 同时记录页面加载及网络请求状态
+type cdpSession struct {
+	conn         *websocket.Conn
+	messages     chan cdpMessage
+	done         chan struct{}
+	readErr      error
+	nextID       int
+	deadline     time.Time
+	url          string
+	loaded       bool
+	inflight     map[string]struct{}
+	lastActivity time.Time
+	statusCode   int
+	checkedHosts map[string]error  // 已按出站访问策略校验过的主机
+	blockedErr   error             // 页面跳转被出站访问策略拒绝的原因
+	headers      map[string]string // 附加到与页面同源的请求的任务请求头
+}
+
+// RenderPageByBrowser
+// 通过 Chrome DevTools Protocol 在无头浏览器中打开页面, 等待选择器出现或网络空闲后返回渲染后的 DOM
+// headers 只附加到与页面同源的请求, cookies 只对页面所在的站点设置, 避免任务的凭据发往页面引用的第三方站点
+func RenderPageByBrowser(pageUrl string, waitSelector string, headers map[string]string, cookies []*http.Cookie) (FetchResult, error) {
+	if config.BrowserEndpoint == "" {
+		return FetchResult{}, errors.New(config.BrowserEndpointEmpty)
+	}
+	timeout := time.Duration(config.Timeout) * time.Second
+	client := &http.Client{Timeout: timeout}
+	endpoint := strings.TrimRight(config.BrowserEndpoint, "/")
+	target, err := newBrowserTarget(client, endpoint)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	// 无论成功与否都关闭标签页, 避免浏览器中堆积
+	defer closeBrowserTarget(client, endpoint, target.ID)
+
+	conn, _, err := websocket.DefaultDialer.Dial(target.WebSocketDebuggerUrl, nil)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	defer conn.Close()
+	session := &cdpSession{
+		conn:         conn,
+		messages:     make(chan cdpMessage, 64),
+		done:         make(chan struct{}),
+		deadline:     time.Now().Add(timeout),
+		url:          pageUrl,
+		inflight:     make(map[string]struct{}),
+		lastActivity: time.Now(),
+		checkedHosts: make(map[string]error),
+		headers:      headers,
+	}
+	defer close(session.done)
+	go session.readLoop()
+
+	html, err := session.render(waitSelector, cookies)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	return FetchResult{StatusCode: session.statusCode, Body: []byte(html)}, nil
+}
+
+// newBrowserTarget
+// 在浏览器中新建空白标签页
+func newBrowserTarget(client *http.Client, endpoint string) (cdpTarget, error) {
+	var target cdpTarget
+	// 新版 Chrome 要求使用 PUT 创建标签页
+	request, err := http.NewRequest(http.MethodPut, endpoint+"/json/new?"+url.QueryEscape("about:blank"), nil)
+	if err != nil {
+		return target, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return target, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return target, fmt.Errorf(config.BrowserRespondStatusError, response.StatusCode)
+	}
+	err = json.NewDecoder(response.Body).Decode(&target)
+	if err != nil {
+		return target, err
+	}
+	if target.WebSocketDebuggerUrl == "" {
+		return target, errors.New(config.BrowserTargetInvalid)
+	}
+	return target, nil
+}
+
+// closeBrowserTarget
+// 关闭标签页
+func closeBrowserTarget(client *http.Client, endpoint string, targetID string) {
+	response, err := client.Get(endpoint + "/json/close/" + url.PathEscape(targetID))
+	if err != nil {
+		return
+	}
+	response.Body.Close()
+}
+
+// render
+// 打开页面并等待渲染完成, 返回页面的 outerHTML
+func (s *cdpSession) render(waitSelector string, cookies []*http.Cookie) (string, error) {
+	for _, method := range []string{"Page.enable", "Network.enable", "Runtime.enable"} {
+		err := s.call(method, nil, nil)
+		if err != nil {
+			return "", err
+		}
+	}
+	// 拦截页面发起的所有请求, 包括跳转及子资源, 逐个按出站访问策略校验
+	err := s.call("Fetch.enable", map[string]interface{}{
+		"patterns": []map[string]string{{"urlPattern": "*"}},
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	// 浏览器自带 User-Agent, 此处统一替换为配置的值, 任务的请求头在拦截同源请求时附加
+	err = s.call("Network.setExtraHTTPHeaders", map[string]interface{}{
+		"headers": map[string]string{"User-Agent": config.UserAgent},
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	// Cookie 按页面地址设置, 浏览器只在请求该站点时携带
+	if len(cookies) > 0 {
+		params := make([]map[string]string, 0, len(cookies))
+		for _, cookie := range cookies {
+			params = append(params, map[string]string{"name": cookie.Name, "value": cookie.Value, "url": s.url})
+		}
+		err = s.call("Network.setCookies", map[string]interface{}{"cookies": params}, nil)
+		if err != nil {
+			return "", err
+		}
+	}
+	var navigate struct {
+		ErrorText string `json:"errorText"`
+	}
+	err = s.call("Page.navigate", map[string]string{"url": s.url}, &navigate)
+	if err != nil {
+		return "", err
+	}
+	if navigate.ErrorText != "" {
+		return "", fmt.Errorf(config.BrowserNavigateFail, s.url, navigate.ErrorText)
+	}
+	// 等待 load 事件
+	for !s.loaded {
+		_, err = s.receive(time.Until(s.deadline))
+		if err != nil {
+			return "", err
+		}
+	}
+	if waitSelector != "" {
+		err = s.waitSelector(waitSelector)
+	} else {
+		err = s.waitNetworkIdle()
+	}
+	if err != nil {
+		return "", err
+	}
+	var html string
+	err = s.evaluate("document.documentElement.outerHTML", &html)
+	return html, err
+}
+
+// waitSelector
+// 轮询直到页面中出现匹配选择器的元素
+func (s *cdpSession) waitSelector(selector string) error {
+	quoted, err := json.Marshal(selector)
+	if err != nil {
+		return err
+	}
+	expression := fmt.Sprintf("document.querySelector(%s) !== null", quoted)
+	for {
+		var found bool
+		err = s.evaluate(expression, &found)
+		if err != nil || found {
+			return err
+		}
+		err = s.drain(config.BrowserPollInterval)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// waitNetworkIdle
+// 等待直到没有进行中的请求且持续 config.BrowserNetworkIdle
+func (s *cdpSession) waitNetworkIdle() error {
+	for {
+		idle := time.Since(s.lastActivity)
+		if len(s.inflight) == 0 && idle >= config.BrowserNetworkIdle {
+			return nil
+		}
+		wait := config.BrowserNetworkIdle
+		if len(s.inflight) == 0 {
+			wait -= idle
+		}
+		_, err := s.receive(wait)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// drain
+// 在指定时长内持续处理事件
+func (s *cdpSession) drain(duration time.Duration) error {
+	until := time.Now().Add(duration)
+	for time.Now().Before(until) {
+		_, err := s.receive(time.Until(until))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evaluate
+// 在页面中执行 JavaScript 表达式并取回结果
+func (s *cdpSession) evaluate(expression string, value interface{}) error {
+	var result struct {
+		Result struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"result"`
+		ExceptionDetails *struct {
+			Text string `json:"text"`
+		} `json:"exceptionDetails"`
+	}
+	err := s.call("Runtime.evaluate", map[string]interface{}{
+		"expression":    expression,
+		"returnByValue": true,
+	}, &result)
+	if err != nil {
+		return err
+	}
+	if result.ExceptionDetails != nil {
+		return fmt.Errorf(config.BrowserEvaluateFail, result.ExceptionDetails.Text)
+	}
+	return json.Unmarshal(result.Result.Value, value)
+}
+
+// call
+// 发送命令并等待其响应, 等待期间到达的事件照常处理
+func (s *cdpSession) call(method string, params interface{}, result interface{}) error {
+	message, err := s.send(method, params)
+	if err != nil {
+		return err
+	}
+	for {
+		response, err := s.receive(time.Until(s.deadline))
+		if err != nil {
+			return err
+		}
+		if response == nil || response.ID != message.ID {
+			continue
+		}
+		if response.Error != nil {
+			return fmt.Errorf(config.BrowserProtocolError, method, response.Error.Message)
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(response.Result, result)
+	}
+}
+
+// send
+// 发送命令, 不等待其响应
+func (s *cdpSession) send(method string, params interface{}) (cdpMessage, error) {
+	s.nextID++
+	message := cdpMessage{ID: s.nextID, Method: method}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return message, err
+		}
+		message.Params = raw
+	}
+	return message, s.conn.WriteJSON(message)
+}
+
+// receive
+// 等待下一条消息, 超过 wait 未收到时返回 nil, 超过整体期限时返回超时错误
+func (s *cdpSession) receive(wait time.Duration) (*cdpMessage, error) {
+	if time.Now().After(s.deadline) {
+		return nil, fmt.Errorf(config.BrowserRenderTimeout, s.url, context.DeadlineExceeded)
+	}
+	if remaining := time.Until(s.deadline); wait > remaining {
+		wait = remaining
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case message, ok := <-s.messages:
+		if !ok {
+			return nil, s.readErr
+		}
+		if message.Method != "" {
+			s.handleEvent(message)
+		}
+		if s.blockedErr != nil {
+			return nil, s.blockedErr
+		}
+		return &message, nil
+	case <-timer.C:
+		return nil, nil
+	}
+}
+
+// readLoop
+// 持续读取 websocket 消息, 连接关闭后关闭消息通道, 会话结束后不再投递
+func (s *cdpSession) readLoop() {
+	defer close(s.messages)
+	for {
+		var message cdpMessage
+		err := s.conn.ReadJSON(&message)
+		if err != nil {
+			s.readErr = err
+			return
+		}
+		select {
+		case s.messages <- message:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// handleEvent
+// 根据事件更新页面加载、网络请求及主文档状态码
+func (s *cdpSession) handleEvent(message cdpMessage) {
+	var params struct {
+		RequestID string `json:"requestId"`
+		Type      string `json:"type"`
+		Response  struct {
+			Status int `json:"status"`
+		} `json:"response"`
+		Request struct {
+			Url     string            `json:"url"`
+			Headers map[string]string `json:"headers"`
+		} `json:"request"`
+		ResourceType string `json:"resourceType"`
+	}
+	_ = json.Unmarshal(message.Params, &params)
+	switch message.Method {
+	case "Fetch.requestPaused":
+		s.handleRequestPaused(params.RequestID, params.Request.Url, params.ResourceType, params.Request.Headers)
+		return
+	case "Page.loadEventFired":
+		s.loaded = true
+	case "Network.requestWillBeSent":
+		s.inflight[params.RequestID] = struct{}{}
+	case "Network.responseReceived":
+		if params.Type == "Document" && s.statusCode == 0 {
+			s.statusCode = params.Response.Status
+		}
+	case "Network.loadingFinished", "Network.loadingFailed":
+		delete(s.inflight, params.RequestID)
+	default:
+		return
+	}
+	s.lastActivity = time.Now()
+}
+
+// handleRequestPaused
+// 按出站访问策略放行或拒绝被拦截的请求, 页面跳转被拒绝时结束渲染, 子资源被拒绝时仅该请求失败
+// 放行与页面同源的请求时附加任务的请求头
+func (s *cdpSession) handleRequestPaused(requestID, requestUrl, resourceType string, requestHeaders map[string]string) {
+	err := s.checkRequestUrl(requestUrl)
+	if err == nil {
+		params := map[string]interface{}{"requestId": requestID}
+		if len(s.headers) > 0 && SameOrigin(requestUrl, s.url) {
+			params["headers"] = mergeRequestHeaders(requestHeaders, s.headers)
+		}
+		_, err = s.send("Fetch.continueRequest", params)
+		if err == nil {
+			return
+		}
+	} else {
+		_, _ = s.send("Fetch.failRequest", map[string]string{"requestId": requestID, "errorReason": "AccessDenied"})
+		if resourceType != "Document" {
+			return
+		}
+	}
+	if s.blockedErr == nil {
+		s.blockedErr = err
+	}
+}
+
+// checkRequestUrl
+// 校验请求地址及其主机的解析结果, 每个主机只解析一次
+// 浏览器自行解析域名, 校验后仍可能解析到其他地址, 严格隔离需另行限制浏览器所在的网络
+func (s *cdpSession) checkRequestUrl(requestUrl string) error {
+	err := CheckOutboundUrl(requestUrl)
+	if err != nil {
+		return err
+	}
+	parsed, err := url.Parse(requestUrl)
+	if err != nil {
+		return err
+	}
+	host := parsed.Hostname()
+	if err, ok := s.checkedHosts[host]; ok {
+		return err
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), s.deadline)
+	defer cancel()
+	// 本地无法解析的域名交由浏览器处理, 只拒绝解析到受限地址的域名
+	_, err = ResolveOutboundHost(ctx, host)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		err = nil
+	}
+	s.checkedHosts[host] = err
+	return err
+}
+
+// mergeRequestHeaders
+// 合并请求原有的请求头及任务的请求头, 同名 (不区分大小写) 时以任务的为准
+// Fetch.continueRequest 的 headers 会替换请求的所有请求头, 须带上原有的请求头
+func mergeRequestHeaders(requestHeaders, headers map[string]string) []map[string]string {
+	merged := make([]map[string]string, 0, len(requestHeaders)+len(headers))
+	overridden := make(map[string]bool, len(headers))
+	for name, value := range headers {
+		overridden[strings.ToLower(name)] = true
+		merged = append(merged, map[string]string{"name": name, "value": value})
+	}
+	for name, value := range requestHeaders {
+		if !overridden[strings.ToLower(name)] {
+			merged = append(merged, map[string]string{"name": name, "value": value})
+		}
+	}
+	return merged
+}
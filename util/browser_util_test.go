@@ -0,0 +1,356 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"surveillance-guy/config"
+)
+
+// fakeBrowser
+// 模拟 Chrome DevTools Protocol 的 HTTP 及 websocket 接口, 无需真实浏览器
+type fakeBrowser struct {
+	server *httptest.Server
+	status int                 // 主文档的响应状态码
+	html   string              // outerHTML 的返回值
+	found  func(poll int) bool // 第 poll 次查询选择器时是否找到元素
+	paused []pausedRequest     // 打开页面后依次拦截的请求, 为空时只拦截打开的页面
+
+	mutex     sync.Mutex
+	methods   []string                     // 收到的命令
+	headers   map[string]string            // Network.setExtraHTTPHeaders 设置的请求头
+	cookies   []map[string]string          // Network.setCookies 设置的 Cookie
+	continued map[string]map[string]string // 放行的请求地址及放行时替换的请求头, 未替换时为 nil
+	polls     int
+	closed    int
+	failed    []string // 被拒绝的请求地址
+}
+
+// pausedRequest
+// Fetch.requestPaused 事件中被拦截的请求
+type pausedRequest struct {
+	url          string
+	resourceType string
+}
+
+// testPageUrl 测试页面地址, 使用公网 IP 避免校验出站访问策略时解析域名
+const testPageUrl = "http://93.184.215.14/"
+
+func newFakeBrowser(t *testing.T) *fakeBrowser {
+	browser := &fakeBrowser{
+		status: http.StatusOK,
+		html:   "<html><body><b>rendered</b></body></html>",
+		found:  func(int) bool { return true },
+
+		continued: make(map[string]map[string]string),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/json/new", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		host := strings.TrimPrefix(browser.server.URL, "http://")
+		fmt.Fprintf(w, `{"id":"T1","webSocketDebuggerUrl":"ws://%s/devtools/page/T1"}`, host)
+	})
+	mux.HandleFunc("/json/close/", func(w http.ResponseWriter, r *http.Request) {
+		browser.mutex.Lock()
+		browser.closed++
+		browser.mutex.Unlock()
+	})
+	mux.HandleFunc("/devtools/page/T1", browser.serveSession)
+	browser.server = httptest.NewServer(mux)
+	t.Cleanup(browser.server.Close)
+	setBrowserConfig(t, browser.server.URL, 5)
+	return browser
+}
+
+// setBrowserConfig
+// 修改测试所需的全局配置, 测试结束后恢复
+func setBrowserConfig(t *testing.T, endpoint string, timeout int) {
+	oldEndpoint, oldTimeout, oldIdle, oldPoll := config.BrowserEndpoint, config.Timeout, config.BrowserNetworkIdle, config.BrowserPollInterval
+	config.BrowserEndpoint = endpoint
+	config.Timeout = timeout
+	config.BrowserNetworkIdle = 100 * time.Millisecond
+	config.BrowserPollInterval = 20 * time.Millisecond
+	t.Cleanup(func() {
+		config.BrowserEndpoint, config.Timeout, config.BrowserNetworkIdle, config.BrowserPollInterval = oldEndpoint, oldTimeout, oldIdle, oldPoll
+	})
+}
+
+// serveSession
+// 应答标签页的调试命令, 打开页面时先逐个推送被拦截的请求, 处理完毕后依次推送主文档请求、响应及 load 事件, 子资源请求稍后完成
+func (b *fakeBrowser) serveSession(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	var writeMutex sync.Mutex
+	send := func(message map[string]interface{}) {
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		_ = conn.WriteJSON(message)
+	}
+	event := func(method string, params map[string]interface{}) {
+		send(map[string]interface{}{"method": method, "params": params})
+	}
+	var (
+		navigateID int
+		queue      []pausedRequest
+	)
+	// 依次推送被拦截的请求, 全部处理后完成页面跳转
+	pauseNext := func() bool {
+		if len(queue) == 0 {
+			return false
+		}
+		event("Fetch.requestPaused", map[string]interface{}{
+			"requestId":    fmt.Sprintf("interception-%d", len(queue)),
+			"request":      map[string]interface{}{"url": queue[0].url, "headers": map[string]string{"Accept": "*/*"}},
+			"resourceType": queue[0].resourceType,
+		})
+		return true
+	}
+	finishNavigation := func() {
+		send(map[string]interface{}{"id": navigateID, "result": map[string]interface{}{"frameId": "F1"}})
+		event("Network.requestWillBeSent", map[string]interface{}{"requestId": "1"})
+		event("Network.responseReceived", map[string]interface{}{
+			"requestId": "1", "type": "Document", "response": map[string]interface{}{"status": b.status},
+		})
+		event("Network.requestWillBeSent", map[string]interface{}{"requestId": "2"})
+		event("Network.loadingFinished", map[string]interface{}{"requestId": "1"})
+		event("Page.loadEventFired", map[string]interface{}{})
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			event("Network.loadingFinished", map[string]interface{}{"requestId": "2"})
+		}()
+	}
+	for {
+		var message cdpMessage
+		if conn.ReadJSON(&message) != nil {
+			return
+		}
+		b.mutex.Lock()
+		b.methods = append(b.methods, message.Method)
+		b.mutex.Unlock()
+		result := map[string]interface{}{}
+		switch message.Method {
+		case "Network.setExtraHTTPHeaders":
+			var params struct {
+				Headers map[string]string `json:"headers"`
+			}
+			_ = json.Unmarshal(message.Params, &params)
+			b.mutex.Lock()
+			b.headers = params.Headers
+			b.mutex.Unlock()
+		case "Network.setCookies":
+			var params struct {
+				Cookies []map[string]string `json:"cookies"`
+			}
+			_ = json.Unmarshal(message.Params, &params)
+			b.mutex.Lock()
+			b.cookies = params.Cookies
+			b.mutex.Unlock()
+		case "Page.navigate":
+			var params struct {
+				Url string `json:"url"`
+			}
+			_ = json.Unmarshal(message.Params, &params)
+			navigateID = message.ID
+			queue = append([]pausedRequest{{url: params.Url, resourceType: "Document"}}, b.paused...)
+			pauseNext()
+			continue
+		case "Fetch.continueRequest", "Fetch.failRequest":
+			send(map[string]interface{}{"id": message.ID, "result": result})
+			var params struct {
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+			}
+			_ = json.Unmarshal(message.Params, &params)
+			b.mutex.Lock()
+			if message.Method == "Fetch.failRequest" {
+				b.failed = append(b.failed, queue[0].url)
+			} else {
+				var headers map[string]string
+				for _, header := range params.Headers {
+					if headers == nil {
+						headers = make(map[string]string)
+					}
+					headers[header.Name] = header.Value
+				}
+				b.continued[queue[0].url] = headers
+			}
+			b.mutex.Unlock()
+			queue = queue[1:]
+			if !pauseNext() {
+				finishNavigation()
+			}
+			continue
+		case "Runtime.evaluate":
+			var params struct {
+				Expression string `json:"expression"`
+			}
+			_ = json.Unmarshal(message.Params, &params)
+			var value interface{} = b.html
+			if strings.Contains(params.Expression, "querySelector") {
+				b.mutex.Lock()
+				b.polls++
+				value = b.found(b.polls)
+				b.mutex.Unlock()
+			}
+			result = map[string]interface{}{"result": map[string]interface{}{"value": value}}
+		}
+		send(map[string]interface{}{"id": message.ID, "result": result})
+	}
+}
+
+func TestRenderPageByBrowserLoad(t *testing.T) {
+	browser := newFakeBrowser(t)
+	browser.status = http.StatusNonAuthoritativeInfo
+	page, err := RenderPageByBrowser(testPageUrl, "", map[string]string{"Authorization": "Bearer token"},
+		[]*http.Cookie{{Name: "sid", Value: "s1"}})
+	if err != nil {
+		t.Fatalf("RenderPageByBrowser() error = %v", err)
+	}
+	if string(page.Body) != browser.html {
+		t.Errorf("Body = %q, want %q", page.Body, browser.html)
+	}
+	if page.StatusCode != http.StatusNonAuthoritativeInfo {
+		t.Errorf("StatusCode = %d, want %d", page.StatusCode, http.StatusNonAuthoritativeInfo)
+	}
+	browser.mutex.Lock()
+	defer browser.mutex.Unlock()
+	if len(browser.headers) != 1 || browser.headers["User-Agent"] != config.UserAgent {
+		t.Errorf("extra headers = %v, want only the User-Agent", browser.headers)
+	}
+	if len(browser.cookies) != 1 || browser.cookies[0]["name"] != "sid" || browser.cookies[0]["url"] != testPageUrl {
+		t.Errorf("cookies = %v, want sid scoped to %s", browser.cookies, testPageUrl)
+	}
+	if headers := browser.continued[testPageUrl]; headers["Authorization"] != "Bearer token" || headers["Accept"] != "*/*" {
+		t.Errorf("page request headers = %v, want the job headers added to the original ones", headers)
+	}
+	if browser.polls != 0 {
+		t.Errorf("selector polled %d times without a wait selector", browser.polls)
+	}
+	if browser.closed != 1 {
+		t.Errorf("target closed %d times, want 1", browser.closed)
+	}
+	if len(browser.failed) != 0 {
+		t.Errorf("requests %v were refused, want none", browser.failed)
+	}
+	if !strings.Contains(strings.Join(browser.methods, " "), "Fetch.enable") {
+		t.Errorf("commands = %v, want request interception enabled", browser.methods)
+	}
+}
+
+func TestRenderPageByBrowserWaitSelector(t *testing.T) {
+	browser := newFakeBrowser(t)
+	browser.found = func(poll int) bool { return poll >= 3 }
+	page, err := RenderPageByBrowser(testPageUrl, "b", nil, nil)
+	if err != nil {
+		t.Fatalf("RenderPageByBrowser() error = %v", err)
+	}
+	if page.StatusCode != http.StatusOK || string(page.Body) != browser.html {
+		t.Errorf("page = %d %q", page.StatusCode, page.Body)
+	}
+	browser.mutex.Lock()
+	defer browser.mutex.Unlock()
+	if browser.polls != 3 {
+		t.Errorf("selector polled %d times, want 3", browser.polls)
+	}
+}
+
+func TestRenderPageByBrowserWaitSelectorTimeout(t *testing.T) {
+	browser := newFakeBrowser(t)
+	browser.found = func(int) bool { return false }
+	config.Timeout = 1
+	start := time.Now()
+	_, err := RenderPageByBrowser(testPageUrl, "#never", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("RenderPageByBrowser() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("timed out after %s, want about 1s", elapsed)
+	}
+	browser.mutex.Lock()
+	defer browser.mutex.Unlock()
+	if browser.closed != 1 {
+		t.Errorf("target closed %d times after a timeout, want 1", browser.closed)
+	}
+}
+
+func TestRenderPageByBrowserWithoutEndpoint(t *testing.T) {
+	setBrowserConfig(t, "", 5)
+	_, err := RenderPageByBrowser(testPageUrl, "", nil, nil)
+	if err == nil || err.Error() != config.BrowserEndpointEmpty {
+		t.Errorf("RenderPageByBrowser() error = %v, want %q", err, config.BrowserEndpointEmpty)
+	}
+}
+
+func TestRenderPageByBrowserBlocksPrivateRedirect(t *testing.T) {
+	browser := newFakeBrowser(t)
+	metadataUrl := "http://169.254.169.254/latest/meta-data/"
+	browser.paused = []pausedRequest{{url: metadataUrl, resourceType: "Document"}}
+	_, err := RenderPageByBrowser(testPageUrl, "", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "169.254.169.254") {
+		t.Fatalf("RenderPageByBrowser() error = %v, want the redirect refused", err)
+	}
+	browser.mutex.Lock()
+	defer browser.mutex.Unlock()
+	if len(browser.failed) != 1 || browser.failed[0] != metadataUrl {
+		t.Errorf("refused requests = %v, want [%s]", browser.failed, metadataUrl)
+	}
+}
+
+func TestRenderPageByBrowserBlocksPrivateSubresource(t *testing.T) {
+	browser := newFakeBrowser(t)
+	internalUrl := "http://10.0.0.1/internal.json"
+	browser.paused = []pausedRequest{
+		{url: "http://93.184.215.14/app.js", resourceType: "Script"},
+		{url: internalUrl, resourceType: "XHR"},
+	}
+	page, err := RenderPageByBrowser(testPageUrl, "", nil, nil)
+	if err != nil {
+		t.Fatalf("RenderPageByBrowser() error = %v", err)
+	}
+	if string(page.Body) != browser.html {
+		t.Errorf("Body = %q, want %q", page.Body, browser.html)
+	}
+	browser.mutex.Lock()
+	defer browser.mutex.Unlock()
+	if len(browser.failed) != 1 || browser.failed[0] != internalUrl {
+		t.Errorf("refused requests = %v, want [%s]", browser.failed, internalUrl)
+	}
+}
+
+func TestRenderPageByBrowserHeadersOnlySameOrigin(t *testing.T) {
+	browser := newFakeBrowser(t)
+	sameOriginUrl := "http://93.184.215.14/api/price"
+	thirdPartyUrl := "http://93.184.216.34/analytics.js"
+	browser.paused = []pausedRequest{
+		{url: sameOriginUrl, resourceType: "XHR"},
+		{url: thirdPartyUrl, resourceType: "Script"},
+	}
+	_, err := RenderPageByBrowser(testPageUrl, "", map[string]string{"Authorization": "Bearer token"}, nil)
+	if err != nil {
+		t.Fatalf("RenderPageByBrowser() error = %v", err)
+	}
+	browser.mutex.Lock()
+	defer browser.mutex.Unlock()
+	if browser.continued[sameOriginUrl]["Authorization"] != "Bearer token" {
+		t.Errorf("same-origin request headers = %v, want the job headers", browser.continued[sameOriginUrl])
+	}
+	if headers, ok := browser.continued[thirdPartyUrl]; !ok || headers != nil {
+		t.Errorf("third-party request continued = %v, headers = %v, want continued unchanged", ok, headers)
+	}
+}
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+
+	"surveillance-guy/config"
+)
+
+// encryptedPrefix 密文前缀, 用于区分密文与明文并预留算法升级
+var encryptedPrefix = "enc:v1:"
+
+// EncryptSecret
+// 使用 config.SecretKey 派生的密钥以 AES-256-GCM 加密, 空串原样返回
+func EncryptSecret(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	aead, err := newSecretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret
+// 解密 EncryptSecret 生成的密文, 空串原样返回
+func DecryptSecret(encrypted string) (string, error) {
+	if encrypted == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(encrypted, encryptedPrefix) {
+		return "", errors.New(config.SecretDecryptFail)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, encryptedPrefix))
+	if err != nil {
+		return "", errors.New(config.SecretDecryptFail)
+	}
+	aead, err := newSecretCipher()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New(config.SecretDecryptFail)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New(config.SecretDecryptFail)
+	}
+	return string(plain), nil
+}
+
+// newSecretCipher
+// 由 config.SecretKey 的 SHA-256 摘要生成 AES-GCM 加密器
+func newSecretCipher() (cipher.AEAD, error) {
+	if config.SecretKey == "" {
+		return nil, errors.New(config.SecretKeyEmpty)
+	}
+	key := sha256.Sum256([]byte(config.SecretKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
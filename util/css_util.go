@@ -0,0 +1,113 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"surveillance-guy/config"
+)
+
+// CSSExtractor
+// CSS 选择器提取器, 取第一个匹配的元素, 提取所有匹配时按文档顺序取所有元素
+// 抓取规则形如 `selector`、`selector::text`、`selector::html` 或 `selector::attr(name)`, 默认取元素文本
+type CSSExtractor struct{}
+
+var (
+	cssSelectText = "text"
+	cssSelectHtml = "html"
+	cssSelectAttr = "attr"
+)
+
+func (CSSExtractor) Extract(content []byte, pattern string) (string, error) {
+	selector, selectMode, attrName, err := ParseCSSPattern(pattern)
+	if err != nil {
+		return "", err
+	}
+	document, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	selection := document.Find(selector).First()
+	if selection.Length() == 0 {
+		return "", ErrTargetNotMatch
+	}
+	return selectCSSValue(selection, selectMode, attrName)
+}
+
+func (CSSExtractor) ExtractAll(content []byte, pattern string) ([]string, error) {
+	selector, selectMode, attrName, err := ParseCSSPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	document, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	var targets []string
+	document.Find(selector).EachWithBreak(func(_ int, selection *goquery.Selection) bool {
+		var target string
+		target, err = selectCSSValue(selection, selectMode, attrName)
+		if err != nil {
+			// 缺少指定属性的元素直接跳过
+			if selectMode == cssSelectAttr {
+				err = nil
+				return true
+			}
+			return false
+		}
+		targets = append(targets, target)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, ErrTargetNotMatch
+	}
+	return targets, nil
+}
+
+// ParseCSSPattern
+// 解析 CSS 抓取规则, 拆分出选择器、取值方式及属性名
+func ParseCSSPattern(pattern string) (selector, selectMode, attrName string, err error) {
+	selector, selectMode = pattern, cssSelectText
+	if index := strings.LastIndex(pattern, "::"); index >= 0 {
+		selector, selectMode = pattern[:index], pattern[index+2:]
+	}
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return "", "", "", fmt.Errorf(config.CSSPatternInvalid, pattern)
+	}
+	switch {
+	case selectMode == cssSelectText || selectMode == cssSelectHtml:
+	case strings.HasPrefix(selectMode, "attr(") && strings.HasSuffix(selectMode, ")"):
+		attrName = strings.TrimSpace(selectMode[len("attr(") : len(selectMode)-1])
+		selectMode = cssSelectAttr
+		if attrName == "" {
+			return "", "", "", fmt.Errorf(config.CSSPatternInvalid, pattern)
+		}
+	default:
+		return "", "", "", fmt.Errorf(config.CSSPatternInvalid, pattern)
+	}
+	return selector, selectMode, attrName, nil
+}
+
+// selectCSSValue
+// 按取值方式获取选中元素的内容
+func selectCSSValue(selection *goquery.Selection, selectMode, attrName string) (string, error) {
+	switch selectMode {
+	case cssSelectHtml:
+		return selection.Html()
+	case cssSelectAttr:
+		value, ok := selection.Attr(attrName)
+		if !ok {
+			return "", ErrTargetNotMatch
+		}
+		return value, nil
+	default:
+		return strings.TrimSpace(selection.Text()), nil
+	}
+}
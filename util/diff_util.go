@@ -0,0 +1,53 @@
+package util
+
+import (
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// DiffSegment
+// 行内差异片段
+type DiffSegment struct {
+	Type string `json:"type"` // 片段类型, equal: 相同, insert: 新增, delete: 删除
+	Text string `json:"text"` // 片段内容
+}
+
+var diffSegmentTypes = map[diffmatchpatch.Operation]string{
+	diffmatchpatch.DiffEqual:  "equal",
+	diffmatchpatch.DiffInsert: "insert",
+	diffmatchpatch.DiffDelete: "delete",
+}
+
+// UnifiedDiff
+// 生成新旧值之间按行比较的 unified 格式差异, context 为上下文行数
+func UnifiedDiff(oldValue, newValue string, context int) string {
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitDiffLines(oldValue),
+		B:        splitDiffLines(newValue),
+		FromFile: "old",
+		ToFile:   "new",
+		Context:  context,
+	})
+	return diff
+}
+
+// splitDiffLines
+// 将值按行切分, 空值视为没有任何行
+func splitDiffLines(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return difflib.SplitLines(value)
+}
+
+// InlineDiff
+// 生成新旧值之间按字符比较的行内差异
+func InlineDiff(oldValue, newValue string) []DiffSegment {
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffCleanupSemantic(dmp.DiffMain(oldValue, newValue, false))
+	segments := make([]DiffSegment, 0, len(diffs))
+	for _, diff := range diffs {
+		segments = append(segments, DiffSegment{Type: diffSegmentTypes[diff.Type], Text: diff.Text})
+	}
+	return segments
+}
@@ -3,6 +3,7 @@ package util
 import (
 	"crypto/tls"
 	"fmt"
+	"net/mail"
 	"strings"
 
 	"gopkg.in/gomail.v2"
@@ -12,8 +13,8 @@ import (
 )
 
 // SendEmail
-// 发送邮件
-func SendEmail(account model.Account, maiTo []string, subject, body string) error {
+// 发送邮件, cc、bcc 分别为抄送和密送列表, 可为空
+func SendEmail(account model.Account, maiTo, cc, bcc []string, subject, body string) error {
 	var (
 		err      error
 		smtpHost string
@@ -30,8 +31,14 @@ func SendEmail(account model.Account, maiTo []string, subject, body string) erro
 	}
 	// 构建邮件
 	newEmailMessage := gomail.NewMessage()
-	newEmailMessage.SetHeader("Form", account.Email)
+	newEmailMessage.SetHeader("From", account.Email)
 	newEmailMessage.SetHeader("To", maiTo...)
+	if len(cc) > 0 {
+		newEmailMessage.SetHeader("Cc", cc...)
+	}
+	if len(bcc) > 0 {
+		newEmailMessage.SetHeader("Bcc", bcc...)
+	}
 	newEmailMessage.SetHeader("Subject", subject)
 	newEmailMessage.SetBody("text/html", body)
 	// 发送邮件
@@ -89,3 +96,113 @@ func EmailIsValid(account model.Account) error {
 	}
 	return nil
 }
+
+// ParseEmailList
+// 解析以逗号或分号分隔的邮箱列表, 去除重复项
+func ParseEmailList(emails string) ([]string, error) {
+	var res []string
+	exist := map[string]bool{}
+	for _, item := range strings.FieldsFunc(emails, func(r rune) bool { return r == ',' || r == ';' }) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		address, err := mail.ParseAddress(item)
+		if err != nil {
+			return nil, fmt.Errorf(config.EmailListInvalid, item)
+		}
+		if !exist[address.Address] {
+			exist[address.Address] = true
+			res = append(res, address.Address)
+		}
+	}
+	return res, nil
+}
+
+// ValidateEmailLists
+// 校验多个以逗号或分号分隔的邮箱列表
+func ValidateEmailLists(lists ...string) error {
+	for _, list := range lists {
+		if _, err := ParseEmailList(list); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EmailNotifier
+// 邮件通知渠道
+type EmailNotifier struct {
+	Account model.Account // 发件账户
+	To      []string      // 收件人
+	CC      []string      // 抄送
+	BCC     []string      // 密送
+}
+
+func (notifier EmailNotifier) Notify(message NotifyMessage) error {
+	return SendEmail(notifier.Account, notifier.To, notifier.CC, notifier.BCC, message.Subject, message.Content)
+}
+
+// NewJobEmailNotifier
+// 根据任务的发件账户、收件人、抄送、密送及接收人分组创建邮件通知渠道, 没有任何收件人时返回 nil
+// 未指定发件账户时沿用旧逻辑, 以 Job.Email 对应的账户发件; 未指定任何收件人时发送给 Job.Email
+func NewJobEmailNotifier(job model.Job) (*EmailNotifier, error) {
+	to, cc, bcc, err := collectJobRecipients(job)
+	if err != nil {
+		return nil, err
+	}
+	if len(to) == 0 && len(cc) == 0 && len(bcc) == 0 {
+		if job.Email == "" {
+			return nil, nil
+		}
+		to = []string{job.Email}
+	}
+	var account model.Account
+	if job.AccountID != 0 {
+		err = config.DataBase.First(&account, job.AccountID).Error
+	} else {
+		err = config.DataBase.Where(config.EmailEqual, job.Email).First(&account).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &EmailNotifier{Account: account, To: to, CC: cc, BCC: bcc}, nil
+}
+
+// collectJobRecipients
+// 合并任务自身及所引用的接收人分组中的收件人、抄送、密送, 去除重复项
+func collectJobRecipients(job model.Job) (to, cc, bcc []string, err error) {
+	lists := [][3]string{{job.Recipients, job.CC, job.BCC}}
+	groupIDs, err := ParseIDList(job.RecipientGroupIDs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(groupIDs) > 0 {
+		var groups []model.RecipientGroup
+		err = config.DataBase.Where("id in (?)", groupIDs).Find(&groups).Error
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, group := range groups {
+			lists = append(lists, [3]string{group.Recipients, group.CC, group.BCC})
+		}
+	}
+	var joined [3][]string
+	for _, list := range lists {
+		for i := range list {
+			if list[i] != "" {
+				joined[i] = append(joined[i], list[i])
+			}
+		}
+	}
+	if to, err = ParseEmailList(strings.Join(joined[0], ",")); err != nil {
+		return nil, nil, nil, err
+	}
+	if cc, err = ParseEmailList(strings.Join(joined[1], ",")); err != nil {
+		return nil, nil, nil, err
+	}
+	if bcc, err = ParseEmailList(strings.Join(joined[2], ",")); err != nil {
+		return nil, nil, nil, err
+	}
+	return to, cc, bcc, nil
+}
@@ -0,0 +1,115 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// Extractor
+// 抓取规则提取器, 根据抓取规则从页面源码中提取目标内容
+type Extractor interface {
+	// Extract 提取第一个匹配的内容
+	Extract(content []byte, pattern string) (string, error)
+	// ExtractAll 按出现顺序提取所有匹配的内容
+	ExtractAll(content []byte, pattern string) ([]string, error)
+}
+
+// ErrTargetNotMatch
+// 抓取规则未匹配到目标内容, 各提取器统一返回该错误, 以 errors.Is 判断
+var ErrTargetNotMatch = errors.New(config.TargetNotMatch)
+
+// Extractors
+// 抓取规则类型与提取器的对应关系, 定时任务与测试接口共用
+var Extractors = map[string]Extractor{
+	model.RE:       RegexExtractor{},
+	model.CSS:      CSSExtractor{},
+	model.XPath:    XPathExtractor{},
+	model.JSONPath: JSONPathExtractor{},
+}
+
+// GetExtractor
+// 根据抓取规则类型获取提取器, 未指定类型时默认使用正则
+func GetExtractor(patternType string) (Extractor, error) {
+	if patternType == "" {
+		patternType = model.RE
+	}
+	extractor, ok := Extractors[patternType]
+	if !ok {
+		return nil, fmt.Errorf(config.PatternTypeNotFound, patternType)
+	}
+	return extractor, nil
+}
+
+// ExtractTarget
+// 根据抓取规则类型及抓取规则提取目标内容
+func ExtractTarget(content []byte, patternType, pattern string) (string, error) {
+	extractor, err := GetExtractor(patternType)
+	if err != nil {
+		return "", err
+	}
+	return extractor.Extract(content, pattern)
+}
+
+// ExtractTargets
+// 根据抓取规则类型及抓取规则提取所有匹配的目标内容
+func ExtractTargets(content []byte, patternType, pattern string) ([]string, error) {
+	extractor, err := GetExtractor(patternType)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := extractor.ExtractAll(content, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, ErrTargetNotMatch
+	}
+	return targets, nil
+}
+
+// JoinTargets
+// 将多个匹配结果按行拼接为一个值以便存储, 结果内部的换行会被替换为空格
+func JoinTargets(targets []string) string {
+	lines := make([]string, 0, len(targets))
+	for _, target := range targets {
+		lines = append(lines, strings.ReplaceAll(strings.ReplaceAll(target, "\r", ""), "\n", " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SplitTargets
+// 将按行拼接存储的值还原为多个匹配结果
+func SplitTargets(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, "\n")
+}
+
+// DiffTargets
+// 将新旧两组匹配结果作为集合比较, 返回新增及移除的结果, 各自保持原有顺序
+func DiffTargets(oldTargets, newTargets []string) (added, removed []string) {
+	oldSet := make(map[string]bool, len(oldTargets))
+	for _, target := range oldTargets {
+		oldSet[target] = true
+	}
+	newSet := make(map[string]bool, len(newTargets))
+	for _, target := range newTargets {
+		newSet[target] = true
+		if !oldSet[target] {
+			added = append(added, target)
+			oldSet[target] = true
+		}
+	}
+	for _, target := range oldTargets {
+		if !newSet[target] {
+			removed = append(removed, target)
+			newSet[target] = true
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,32 @@
+package util
+
+import (
+	"errors"
+	"testing"
+
+	"surveillance-guy/model"
+)
+
+func TestExtractorsReturnErrTargetNotMatch(t *testing.T) {
+	html := []byte(`<html><body><p class="price">42</p></body></html>`)
+	tests := []struct {
+		patternType, pattern string
+		content              []byte
+	}{
+		{model.RE, `<b>(.*?)</b>`, html},
+		{model.CSS, `.missing`, html},
+		{model.XPath, `//span`, html},
+		{model.JSONPath, `$.missing`, []byte(`{"price": 42}`)},
+	}
+	for _, test := range tests {
+		if _, err := ExtractTarget(test.content, test.patternType, test.pattern); !errors.Is(err, ErrTargetNotMatch) {
+			t.Errorf("ExtractTarget(%s, %q) error = %v, want ErrTargetNotMatch", test.patternType, test.pattern, err)
+		}
+		if _, err := ExtractTargets(test.content, test.patternType, test.pattern); !errors.Is(err, ErrTargetNotMatch) {
+			t.Errorf("ExtractTargets(%s, %q) error = %v, want ErrTargetNotMatch", test.patternType, test.pattern, err)
+		}
+	}
+	if _, err := ExtractPageText(html, "#missing"); !errors.Is(err, ErrTargetNotMatch) {
+		t.Errorf("ExtractPageText() error = %v, want ErrTargetNotMatch", err)
+	}
+}
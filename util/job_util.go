@@ -2,15 +2,20 @@ package util
 
 import (
 	"bufio"
-	"crypto/tls"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"regexp"
+	"net/url"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/jinzhu/gorm"
+	"github.com/robfig/cron/v3"
 	"golang.org/x/net/html/charset"
 	"golang.org/x/text/transform"
 
@@ -18,27 +23,103 @@ import (
 	"surveillance-guy/model"
 )
 
+// JobRun
+// 调度器中的定时任务, 只保存任务 ID, 每次执行时从数据库加载最新的任务配置
 type JobRun struct {
-	Job model.Job
+	JobID uint
 }
 
 func (jobRun JobRun) Run() {
 	// Run 执行定时任务
 	infoPrefix := "[Job#%d][%s]"
+	// 加载任务的最新配置, 任务已删除或停止时跳过, 遗留的调度由核对程序移除
+	var job model.Job
+	err := config.DataBase.First(&job, jobRun.JobID).Error
+	if err != nil {
+		glog.Errorf("[Job#%d]Loading the job failed, skipping: %s", jobRun.JobID, err.Error())
+		return
+	}
+	if job.Status != 0 {
+		glog.Warningf(infoPrefix+"The job is stopped, skipping", job.ID, job.Name)
+		return
+	}
+	// 按重叠执行策略处理上次执行尚未结束的情况
+	release, ok := acquireJobRun(job)
+	if !ok {
+		glog.Warningf(infoPrefix+"The last run is still running, skipping", job.ID, job.Name)
+		return
+	}
+	defer release()
+	// 等待全局及同一主机的执行名额, 等待期间任务可能已被修改, 取得名额后重新加载
+	releaseSlots := acquireRunSlots(job)
+	defer releaseSlots()
+	err = config.DataBase.First(&job, jobRun.JobID).Error
+	if err != nil {
+		glog.Errorf(infoPrefix+"Reloading the job failed, skipping: %s", job.ID, job.Name, err.Error())
+		return
+	}
+	if job.Status != 0 {
+		glog.Warningf(infoPrefix+"The job was stopped while waiting for a run slot, skipping", job.ID, job.Name)
+		return
+	}
 	// 任务执行前后打印提示信息
 	glog.Infof("======= [Job#%d][%s][%s][Status: %d][EntryID: %d][OldValue: %s] Start...",
-		jobRun.Job.ID, jobRun.Job.Name, jobRun.Job.Cron, jobRun.Job.Status, jobRun.Job.EntryID, jobRun.Job.OldValue)
-	defer glog.Infof("-------- [Job#%d][%s][%s][Status: %d][EntryID: %d][OldValue: %s] End --------",
-		jobRun.Job.ID, jobRun.Job.Name, jobRun.Job.Cron, jobRun.Job.Status, jobRun.Job.EntryID, jobRun.Job.OldValue)
+		job.ID, job.Name, job.Cron, job.Status, job.EntryID, job.OldValue)
+	defer func() {
+		// 结束时重新读取, 打印本次执行后的值
+		config.DataBase.Select("old_value").First(&job, job.ID)
+		glog.Infof("-------- [Job#%d][%s][%s][Status: %d][EntryID: %d][OldValue: %s] End --------",
+			job.ID, job.Name, job.Cron, job.Status, job.EntryID, job.OldValue)
+	}()
+	// 创建本次执行记录, 先行写入以便变动记录关联
+	record := model.RunRecord{
+		JobID:        job.ID,
+		StartTime:    time.Now(),
+		Status:       model.RunStatusRunning,
+		NotifyStatus: model.NotifyStatusNone,
+	}
+	err = config.DataBase.Create(&record).Error
+	if err != nil {
+		glog.Errorf(infoPrefix+"Creating the run record failed: %s", job.ID, job.Name, err.Error())
+	}
 	// 执行定时任务
-	err := WatchJob(jobRun.Job)
+	err = WatchJob(job, &record)
+	record.EndTime = time.Now()
 	if err != nil {
-		glog.Errorf(infoPrefix+err.Error(), jobRun.Job.ID, jobRun.Job.Name)
+		glog.Errorf(infoPrefix+err.Error(), job.ID, job.Name)
+		record.Status = model.RunStatusFailed
+		record.Error = truncateRecordError(err)
+		if record.FailureType == "" {
+			record.FailureType = model.FailureOther
+		}
+	} else if record.Status == model.RunStatusRunning {
+		record.Status = model.RunStatusSuccess
 	}
+	// 更新执行记录
+	err = config.DataBase.Save(&record).Error
+	if err != nil {
+		glog.Errorf(infoPrefix+"Saving the run record failed: %s", job.ID, job.Name, err.Error())
+	}
+	// 更新连续失败次数, 按需发送任务异常或恢复通知
+	err = TrackJobFailure(job.ID, record)
+	if err != nil {
+		glog.Errorf(infoPrefix+"Tracking the failure streak failed: %s", job.ID, job.Name, err.Error())
+	}
+}
+
+// truncateRecordError
+// 失败原因超出执行记录字段长度时按字符截断, 避免保存执行记录失败
+func truncateRecordError(err error) string {
+	message := []rune(err.Error())
+	if len(message) <= model.MaxErrorLength {
+		return string(message)
+	}
+	return string(message[:model.MaxErrorLength-3]) + "..."
 }
 
-func WatchJob(job model.Job) error {
+func WatchJob(job model.Job, record *model.RunRecord) error {
 	// 爬取目标页面指定内容, 和数据库中对比, 如果有变动, 发送邮件通知
+	// 抓取及通知的过程信息写入执行记录 record
 	// 定时任务结束时输出缓冲区日志
 	defer glog.Flush()
 
@@ -47,17 +128,61 @@ func WatchJob(job model.Job) error {
 
 	// 爬取目标页面 html
 	glog.Infof(infoPrefix+"Crawling the target page...", job.ID, job.Name)
-	html, err := GetHtmlByUrl(job.Url)
+	fetchStart := time.Now()
+	page, attempts, err := FetchJobPageWithRetry(job)
+	record.FetchDuration = time.Since(fetchStart).Milliseconds()
+	record.HTTPStatus = page.StatusCode
+	record.BytesFetched = len(page.Body)
+	if job.MonitorMode == model.MonitorHash {
+		record.BytesFetched = int(page.Size)
+	}
+	record.Attempts = attempts
 	if err != nil {
+		// 限流等待过长时推迟到下次执行, 不计为失败
+		var throttleErr *ThrottleError
+		if errors.As(err, &throttleErr) {
+			glog.Warningf(infoPrefix+"%s, deferring to the next run", job.ID, job.Name, err.Error())
+			record.Status = model.RunStatusDeferred
+			record.Error = truncateRecordError(err)
+			return nil
+		}
+		record.FailureType = ClassifyFetchError(err, page).Type
 		return err
 	}
+	// 服务端返回 304 或校验头与上次相同, 内容未变动, 无需提取和比较
+	if page.Unchanged {
+		glog.Infof(infoPrefix+"The page is not modified since the last run, skipping", job.ID, job.Name)
+		record.Status = model.RunStatusNotModified
+		return nil
+	}
 	// 匹配指定内容, 获取新值
 	glog.Infof(infoPrefix+"Matching the specified content...", job.ID, job.Name)
-	// 根据正则表达式拿到对应内容
-	jobNewValue, err = MatchTargetByRegexPattern(html, job.Pattern)
+	// 根据监控方式及抓取规则类型拿到对应内容, 多值匹配时按行拼接所有结果, text 方式下整页文本作为一个值
+	if job.MonitorMode == model.MonitorText || job.MonitorMode == model.MonitorHash {
+		job.MultiMatch = false
+	}
+	newTargets, err := ExtractJobTargets(job, page)
 	if err != nil {
+		if errors.Is(err, ErrTargetNotMatch) {
+			record.FailureType = model.FailureNoMatch
+		}
 		return err
 	}
+	// 按规范化步骤处理抓取结果, 以处理后的值存储和比较, 避免空白、时间戳等无关差异触发通知
+	// hash 方式的摘要无需规范化
+	if job.MonitorMode != model.MonitorHash {
+		newTargets, _, err = NormalizeTargets(newTargets, job.Normalizers, job.NumberLocale)
+		if err != nil {
+			return err
+		}
+	}
+	jobNewValue = newTargets[0]
+	if job.MultiMatch {
+		jobNewValue = JoinTargets(newTargets)
+		// 拼接时会去掉结果中的换行, 以存储后的形式比较, 避免跨行的结果每次都被视为变动
+		newTargets = SplitTargets(jobNewValue)
+	}
+	record.Value = jobNewValue
 	glog.Infof(infoPrefix+"Got the new value: %s", job.ID, job.Name, jobNewValue)
 	// 从数据库取出旧值
 	glog.Infof(infoPrefix+"Getting the old value from Database...", job.ID, job.Name)
@@ -68,31 +193,96 @@ func WatchJob(job model.Job) error {
 	}
 	jobOldValue = tmpJob.OldValue
 	glog.Infof(infoPrefix+"Got the old value: %s", job.ID, job.Name, jobOldValue)
-	// 判断新旧值是否相同
+	// 本次响应的校验头供下次条件请求使用, hash 方式同时记录大小供通知使用
+	// 须在新值及变动历史写入后再保存, 否则处理变动失败时下次请求得到 304, 该变动将被遗漏
+	validators := map[string]interface{}{
+		"etag":          page.Header.Get("ETag"),
+		"last_modified": page.Header.Get("Last-Modified"),
+	}
+	if job.MonitorMode == model.MonitorHash {
+		validators["content_size"] = page.Size
+	}
+	// 判断新旧值是否相同, 多值匹配时作为集合比较, 仅顺序变化不算变动
 	glog.Infof(infoPrefix+"Comparing the new value: '%s' and the old value: '%s'...", job.ID, job.Name, jobNewValue, jobOldValue)
-	if jobNewValue == jobOldValue {
-		// 相同, 不管
+	var addedTargets, removedTargets []string
+	changed := jobNewValue != jobOldValue
+	if job.MultiMatch {
+		addedTargets, removedTargets = DiffTargets(SplitTargets(jobOldValue), newTargets)
+		changed = len(addedTargets) > 0 || len(removedTargets) > 0
+		glog.Infof(infoPrefix+"Added items: %q, removed items: %q", job.ID, job.Name, addedTargets, removedTargets)
+	}
+	if !changed {
+		// 相同, 仅更新校验头
 		glog.Infof(infoPrefix+"The new value is the same as the old value, no need to send email, skipping", job.ID, job.Name)
+		err = config.DataBase.Model(&model.Job{}).Where(config.IDEqual, job.ID).Updates(validators).Error
+		if err != nil {
+			return err
+		}
 	} else {
-		// 不同, 更新数据库, 发送通知
+		// 不同, 更新数据库, 满足触发规则时发送通知
 		glog.Infof(infoPrefix+"The new value is different from the old value, updating and sending email...", job.ID, job.Name)
-		// 更形
-		err = config.DataBase.Model(&job).Update("old_value", jobNewValue).Error
+		// 触发规则与上次通知时的值比较, 未通知的变动不改变基准, 避免逐次小幅变化永远达不到阈值
+		// 尚未有基准时以旧值为基准并保存
+		triggerValue := tmpJob.TriggerValue
+		if triggerValue == "" {
+			triggerValue = jobOldValue
+		}
+		triggered, err := EvaluateTriggers(job, triggerValue, jobNewValue)
 		if err != nil {
 			return err
 		}
-		var account model.Account
-		err = config.DataBase.Where("email = ?", job.Email).First(&account).Error
+		record.Changed = true
+		if !triggered {
+			validators["trigger_value"] = triggerValue
+		}
+		// 新值、变动历史及校验头在同一事务中写入, 避免部分写入后下次请求得到 304 而遗漏变动
+		err = config.DataBase.Transaction(func(tx *gorm.DB) error {
+			// 更形
+			err := tx.Model(&job).Update("old_value", jobNewValue).Error
+			if err != nil {
+				return err
+			}
+			// 追加变动历史
+			err = tx.Create(&model.ValueChange{
+				JobID:       job.ID,
+				Value:       jobNewValue,
+				Hash:        HashValue(jobNewValue),
+				DetectedAt:  time.Now(),
+				RunRecordID: record.ID,
+			}).Error
+			if err != nil {
+				return err
+			}
+			return tx.Model(&model.Job{}).Where(config.IDEqual, job.ID).Updates(validators).Error
+		})
+		if err != nil {
+			return err
+		}
+		if !triggered {
+			glog.Infof(infoPrefix+"The trigger rules are not satisfied, skipping the notification", job.ID, job.Name)
+			record.NotifyStatus = model.NotifyStatusSkip
+			return nil
+		}
+		// 渲染通知标题及内容
+		data := NewNotifyData(job, jobOldValue, jobNewValue, addedTargets, removedTargets, record.StartTime)
+		if job.MonitorMode == model.MonitorHash {
+			data.OldHash, data.NewHash = jobOldValue, jobNewValue
+			data.OldSize, data.NewSize = tmpJob.ContentSize, page.Size
+		}
+		message, err := BuildNotifyMessage(job, data)
 		if err != nil {
+			record.NotifyStatus = model.NotifyStatusFailed
 			return err
 		}
-		// 替换 job.Content 内容中的变量
-		compileTargetRes, _ := regexp.Compile("%target%")
-		job.Content = compileTargetRes.ReplaceAllLiteralString(job.Content, jobNewValue)
-		compileNameRes, _ := regexp.Compile("%name%")
-		job.Content = compileNameRes.ReplaceAllLiteralString(job.Content, job.Name)
-		// 发送通知
-		err = SendEmail(account, []string{job.Email}, fmt.Sprintf(config.EmailSubject, job.Name), job.Content)
+		// 发送通知, 邮件及绑定的通知渠道
+		err = NotifyJob(job, message)
+		if err != nil {
+			record.NotifyStatus = model.NotifyStatusFailed
+			return err
+		}
+		record.NotifyStatus = model.NotifyStatusSent
+		// 已通知的值作为下次触发规则比较的基准
+		err = config.DataBase.Model(&model.Job{}).Where(config.IDEqual, job.ID).Update("trigger_value", jobNewValue).Error
 		if err != nil {
 			return err
 		}
@@ -100,44 +290,97 @@ func WatchJob(job model.Job) error {
 	return nil
 }
 
-// GetHtmlByUrl
-// 抓取指定 url 的 html 页面源码
-func GetHtmlByUrl(url string) ([]byte, error) {
-	// 生成 Client 客户端
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-		},
-		Timeout: time.Duration(config.Timeout) * time.Second,
-	}
-	// 构建请求
-	request, err := http.NewRequest("GET", url, nil)
+// FetchResult
+// 页面抓取结果
+type FetchResult struct {
+	StatusCode int         // 响应状态码
+	Header     http.Header // 响应头
+	Body       []byte      // 转码后的响应体, hash 方式下为空
+	Hash       string      // hash 方式下响应体的 SHA-256 摘要
+	Size       int64       // hash 方式下响应体的字节数
+	Unchanged  bool        // 内容未变动, 服务端返回 304 或响应的 ETag、Last-Modified 与上次相同, 未下载内容
+}
+
+// FetchJobPage
+// 按任务的抓取方式获取页面, browser 方式经无头浏览器渲染, 否则直接请求
+func FetchJobPage(job model.Job) (FetchResult, error) {
+	err := ValidateFetchMode(job.FetchMode)
 	if err != nil {
-		return []byte{}, err
+		return FetchResult{}, err
 	}
-	request.Header.Add("User-Agent", config.UserAgent)
-	// 发起请求
-	response, err := client.Do(request)
-	if err != nil {
-		return []byte{}, err
+	if job.SessionID != 0 {
+		return FetchJobPageWithSession(job)
 	}
-	// 关闭响应体
-	defer response.Body.Close()
-	html, err := DataEncoding(response.Body)
+	return fetchJobPageOnce(job, nil)
+}
+
+// fetchJobPageOnce
+// 按任务的抓取方式获取一次页面, cookies 为登录会话附加的 Cookie
+func fetchJobPageOnce(job model.Job, cookies []*http.Cookie) (FetchResult, error) {
+	if job.FetchMode == model.FetchBrowser {
+		pageUrl, err := BuildJobUrl(job)
+		if err != nil {
+			return FetchResult{}, err
+		}
+		// 打开页面前先行校验目标地址, 页面内的跳转及子资源在渲染时逐个拦截校验
+		err = CheckOutboundUrl(pageUrl)
+		if err != nil {
+			return FetchResult{}, err
+		}
+		parsed, _ := url.Parse(pageUrl)
+		_, err = ResolveOutboundHost(context.Background(), parsed.Hostname())
+		if err != nil {
+			return FetchResult{}, err
+		}
+		err = CheckRobots(job, parsed)
+		if err != nil {
+			return FetchResult{}, err
+		}
+		err = WaitHost(context.Background(), parsed.Hostname())
+		if err != nil {
+			return FetchResult{}, err
+		}
+		headers, cookies, err := browserRequestCredentials(job, cookies)
+		if err != nil {
+			return FetchResult{}, err
+		}
+		return RenderPageByBrowser(pageUrl, job.WaitSelector, headers, cookies)
+	}
+	return FetchHTTPPage(job, cookies)
+}
+
+// ValidateFetchMode
+// 校验抓取方式, 为空时视为 http
+func ValidateFetchMode(mode string) error {
+	if mode == "" || mode == model.FetchHTTP || mode == model.FetchBrowser {
+		return nil
+	}
+	return fmt.Errorf(config.FetchModeNotFound, mode)
+}
+
+// GetHtmlByUrl
+// 抓取指定 url 的 html 页面源码
+func GetHtmlByUrl(url string) ([]byte, error) {
+	page, err := GetPageByUrl(url)
 	if err != nil {
 		return []byte{}, err
 	}
-	return html, nil
+	return page.Body, nil
+}
+
+// GetPageByUrl
+// 以默认请求配置抓取指定 url 的页面, 返回状态码、响应头及页面源码
+func GetPageByUrl(url string) (FetchResult, error) {
+	return FetchHTTPPage(model.Job{Url: url}, nil)
 }
 
 // DataEncoding
 // 自动转换页面编码, html 页面本身决定编码
 func DataEncoding(r io.Reader) ([]byte, error) {
 	oldReader := bufio.NewReader(r)
+	// 页面不足 1024 字节时 Peek 会返回 io.EOF, 此时仍可根据已读到的内容判断编码
 	bytes, err := oldReader.Peek(1024)
-	if err != nil {
+	if err != nil && err != io.EOF {
 		return []byte{}, err
 	}
 	encoding, _, _ := charset.DetermineEncoding(bytes, "")
@@ -163,6 +406,13 @@ func JobIsExistInDataBaseByName(jobName string) bool {
 	}
 }
 
+// HashValue
+// 计算抓取值的 SHA-256 摘要
+func HashValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
 // PrintAllJobs
 // 打印所有任务
 func PrintAllJobs() {
@@ -173,6 +423,28 @@ func PrintAllJobs() {
 	glog.Infof("Cuurent all jobs: %s", jobs)
 }
 
+// ScheduleJob
+// 在调度器中重新注册任务并将新的 EntryID 写回数据库, 停止状态的任务只移除不注册
+// 移除的是数据库中记录的 EntryID, 不采用 job 中可能来自请求的值
+func ScheduleJob(job *model.Job) error {
+	entryID, err := GetJobEntryIDByJobID(job.ID)
+	if err != nil {
+		return err
+	}
+	if entryID != 0 {
+		config.Cron.Remove(cron.EntryID(entryID))
+	}
+	job.EntryID = 0
+	if job.Status == 0 {
+		newEntryID, err := config.Cron.AddJob(job.Cron, JobRun{JobID: job.ID})
+		if err != nil {
+			return err
+		}
+		job.EntryID = int(newEntryID)
+	}
+	return config.DataBase.Model(job).Update("entry_id", job.EntryID).Error
+}
+
 func GetJobEntryIDByJobID(id uint) (int, error) {
 	var err error
 	job := model.Job{}
@@ -0,0 +1,185 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// openTestDataBase
+// 在临时目录中创建 sqlite 数据库
+func openTestDataBase(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(config.DialectSqlite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("opening the database failed: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// setTestDataBase
+// 创建执行过所有迁移的数据库作为全局数据库, 并允许访问本机的测试服务, 测试结束后恢复
+func setTestDataBase(t *testing.T) {
+	db := openTestDataBase(t)
+	if _, err := MigrateUp(db); err != nil {
+		t.Fatalf("MigrateUp() error = %v", err)
+	}
+	oldDataBase, oldDenyPrivate := config.DataBase, config.DenyPrivateNetworks
+	config.DataBase, config.DenyPrivateNetworks = db, false
+	t.Cleanup(func() {
+		config.DataBase, config.DenyPrivateNetworks = oldDataBase, oldDenyPrivate
+	})
+}
+
+// valueServer
+// 返回当前设置的值的测试页面
+type valueServer struct {
+	mutex sync.Mutex
+	value string
+}
+
+func (s *valueServer) set(value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.value = value
+}
+
+func newValueServer(t *testing.T) (*valueServer, string) {
+	page := &valueServer{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page.mutex.Lock()
+		defer page.mutex.Unlock()
+		fmt.Fprintf(w, "<html><body><b>%s</b></body></html>", page.value)
+	}))
+	t.Cleanup(server.Close)
+	return page, server.URL
+}
+
+// runTestJob
+// 执行一次任务, 返回执行记录
+func runTestJob(t *testing.T, jobID uint) model.RunRecord {
+	var job model.Job
+	if err := config.DataBase.First(&job, jobID).Error; err != nil {
+		t.Fatalf("loading the job failed: %v", err)
+	}
+	record := model.RunRecord{JobID: jobID, NotifyStatus: model.NotifyStatusNone}
+	config.DataBase.Create(&record)
+	if err := WatchJob(job, &record); err != nil {
+		t.Fatalf("WatchJob() error = %v", err)
+	}
+	return record
+}
+
+func TestWatchJobTriggerBaseline(t *testing.T) {
+	setTestDataBase(t)
+	page, pageUrl := newValueServer(t)
+	hookUrl, _ := newNotifyServer(t, http.StatusOK, "ok")
+	channel := model.Channel{Name: "hook", Type: model.ChannelWebhook, Url: hookUrl}
+	config.DataBase.Create(&channel)
+	job := model.Job{
+		Name:         "price",
+		Url:          pageUrl,
+		Pattern:      `<b>(.*?)</b>`,
+		ChannelIDs:   fmt.Sprint(channel.ID),
+		TriggerRules: `[{"op": "percent_change", "value": "-5"}]`,
+	}
+	config.DataBase.Create(&job)
+
+	// 价格每次下跌 2%, 与上次通知时的值相比累计达到 5% 时才通知
+	steps := []struct {
+		value      string
+		wantNotify string
+	}{
+		{"100", model.NotifyStatusSkip},
+		{"98", model.NotifyStatusSkip},
+		{"96", model.NotifyStatusSkip},
+		{"94", model.NotifyStatusSent},
+		{"92", model.NotifyStatusSkip},
+		{"89", model.NotifyStatusSent},
+	}
+	for _, step := range steps {
+		page.set(step.value)
+		record := runTestJob(t, job.ID)
+		if !record.Changed || record.NotifyStatus != step.wantNotify {
+			t.Errorf("value %s: changed = %v, notify status = %s, want %s", step.value, record.Changed, record.NotifyStatus, step.wantNotify)
+		}
+		var stored model.Job
+		config.DataBase.First(&stored, job.ID)
+		if stored.OldValue != step.value {
+			t.Errorf("value %s: old value = %s", step.value, stored.OldValue)
+		}
+	}
+	var stored model.Job
+	config.DataBase.First(&stored, job.ID)
+	if stored.TriggerValue != "89" {
+		t.Errorf("trigger value = %q, want the last notified value 89", stored.TriggerValue)
+	}
+	var changes int
+	config.DataBase.Model(&model.ValueChange{}).Where("job_id = ?", job.ID).Count(&changes)
+	if changes != len(steps) {
+		t.Errorf("%d value changes recorded, want %d", changes, len(steps))
+	}
+}
+
+func TestTruncateRecordError(t *testing.T) {
+	if got := truncateRecordError(errors.New("timeout")); got != "timeout" {
+		t.Errorf("truncateRecordError() = %q, want it unchanged", got)
+	}
+	// 按字符而不是字节截断, 不会截断到多字节字符中间
+	long := strings.Repeat("错", model.MaxErrorLength+10)
+	got := truncateRecordError(errors.New(long))
+	if length := len([]rune(got)); length != model.MaxErrorLength {
+		t.Errorf("truncateRecordError() length = %d, want %d", length, model.MaxErrorLength)
+	}
+	if !strings.HasSuffix(got, "错...") {
+		t.Errorf("truncateRecordError() = ...%q, want an ellipsis after whole characters", got[len(got)-12:])
+	}
+}
+
+func TestWatchJobRollsBackPartialChange(t *testing.T) {
+	setTestDataBase(t)
+	page, pageUrl := newValueServer(t)
+	job := model.Job{Name: "price", Url: pageUrl, Pattern: `<b>(.*?)</b>`, OldValue: "100"}
+	config.DataBase.Create(&job)
+
+	// 变动历史写入失败时, 新值不应单独保存, 下次执行仍能检测到该变动
+	config.DataBase.DropTable(&model.ValueChange{})
+	page.set("90")
+	var stored model.Job
+	config.DataBase.First(&stored, job.ID)
+	record := model.RunRecord{JobID: job.ID}
+	if err := WatchJob(stored, &record); err == nil {
+		t.Fatal("WatchJob() error = nil, want the value change insert to fail")
+	}
+	config.DataBase.First(&stored, job.ID)
+	if stored.OldValue != "100" {
+		t.Errorf("old value = %q after a failed change, want it rolled back to 100", stored.OldValue)
+	}
+}
+
+func TestWatchJobNoMatch(t *testing.T) {
+	setTestDataBase(t)
+	page, pageUrl := newValueServer(t)
+	page.set("100")
+	job := model.Job{Name: "price", Url: pageUrl, Pattern: `<i>(.*?)</i>`}
+	config.DataBase.Create(&job)
+
+	record := model.RunRecord{JobID: job.ID}
+	if err := WatchJob(job, &record); !errors.Is(err, ErrTargetNotMatch) {
+		t.Fatalf("WatchJob() error = %v, want ErrTargetNotMatch", err)
+	}
+	if record.FailureType != model.FailureNoMatch {
+		t.Errorf("failure type = %q, want %q", record.FailureType, model.FailureNoMatch)
+	}
+}
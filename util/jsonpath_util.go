@@ -0,0 +1,71 @@
+package util
+
+import (
+	"encoding/json"
+
+	"github.com/ohler55/ojg/jp"
+	"github.com/ohler55/ojg/oj"
+)
+
+// JSONPathExtractor
+// JSONPath 提取器, 将页面内容解析为 JSON 后执行 JSONPath 表达式, 支持数组下标、切片、通配符及过滤表达式
+// 只有一个结果时返回该结果, 多个结果时返回由所有结果组成的 JSON 数组, 提取所有匹配时每个结果各自返回
+type JSONPathExtractor struct{}
+
+func (JSONPathExtractor) Extract(content []byte, pattern string) (string, error) {
+	results, err := QueryByJSONPath(content, pattern)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 1 {
+		return FormatJSONValue(results[0])
+	}
+	return FormatJSONValue(results)
+}
+
+func (JSONPathExtractor) ExtractAll(content []byte, pattern string) ([]string, error) {
+	results, err := QueryByJSONPath(content, pattern)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]string, 0, len(results))
+	for _, result := range results {
+		target, err := FormatJSONValue(result)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// QueryByJSONPath
+// 对 JSON 内容执行 JSONPath 表达式, 返回所有结果
+func QueryByJSONPath(content []byte, pattern string) ([]any, error) {
+	expr, err := jp.ParseString(pattern)
+	if err != nil {
+		return nil, err
+	}
+	data, err := oj.Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	results := expr.Get(data)
+	if len(results) == 0 {
+		return nil, ErrTargetNotMatch
+	}
+	return results, nil
+}
+
+// FormatJSONValue
+// 将 JSONPath 结果转换为字符串, 字符串原样返回, 其余类型序列化为 JSON (对象的键有序, 便于比较)
+func FormatJSONValue(value any) (string, error) {
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	res, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(res), nil
+}
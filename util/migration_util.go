@@ -0,0 +1,724 @@
+package util
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// Migration
+// 一个版本的数据库迁移, Up 升级, Down 回滚
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(db *gorm.DB) error
+	Down    func(db *gorm.DB) error
+}
+
+// MigrationState
+// 迁移的执行状态
+type MigrationState struct {
+	Version   uint       `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt"`
+}
+
+// Migrations 所有迁移, 按版本号升序排列, 新的表结构变更在末尾追加新版本, 已发布的版本不可修改
+// 各版本只使用 schema_util.go 中冻结的表结构, 不引用 model 中会随功能变化的结构体
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up: func(db *gorm.DB) error {
+			// 已由旧版本 AutoMigrate 创建的表保持原样, 新数据库按旧版本的结构建表
+			err := createMissingTables(db, schemaV0Account{}, schemaV0Job{}, schemaV0Template{})
+			if err != nil {
+				return err
+			}
+			// 旧版本中任务模板的定时配置列名误写为 corn, 在此更正
+			err = renameColumn(db, schemaV0Template{}, "corn", "cron")
+			if err == nil {
+				err = addColumns(db, schemaV1Job{})
+			}
+			if err == nil {
+				err = addColumns(db, schemaV1Template{})
+			}
+			if err != nil {
+				return err
+			}
+			return createTables(db, schemaV1RunRecord{}, schemaV1ValueChange{}, schemaV1Channel{}, schemaV1RecipientGroup{})
+		},
+		// 迁移机制引入前即已存在的表及列保留不动, 只回滚本版本新建的表、新增的列及列名更正
+		Down: func(db *gorm.DB) error {
+			err := db.DropTableIfExists(schemaV1RecipientGroup{}, schemaV1Channel{}, schemaV1ValueChange{},
+				schemaV1RunRecord{}).Error
+			if err == nil {
+				err = dropColumns(db, schemaV1Template{})
+			}
+			if err == nil {
+				err = dropColumns(db, schemaV1Job{})
+			}
+			if err != nil {
+				return err
+			}
+			return renameColumn(db, schemaV0Template{}, "cron", "corn")
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add job fetch mode",
+		Up: func(db *gorm.DB) error {
+			return addColumns(db, schemaV2Job{})
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, schemaV2Job{})
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add job request config",
+		Up: func(db *gorm.DB) error {
+			return addColumns(db, schemaV3Job{})
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, schemaV3Job{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add login sessions",
+		Up: func(db *gorm.DB) error {
+			err := createTables(db, schemaV4Session{})
+			if err != nil {
+				return err
+			}
+			return addColumns(db, schemaV4Job{})
+		},
+		Down: func(db *gorm.DB) error {
+			err := db.DropTableIfExists(schemaV4Session{}).Error
+			if err != nil {
+				return err
+			}
+			return dropColumns(db, schemaV4Job{})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add job proxy and tls options",
+		Up: func(db *gorm.DB) error {
+			return addColumns(db, schemaV5Job{})
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, schemaV5Job{})
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add run failure type and attempts",
+		Up: func(db *gorm.DB) error {
+			return addColumns(db, schemaV6RunRecord{})
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, schemaV6RunRecord{})
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add job failure streak",
+		Up: func(db *gorm.DB) error {
+			return addColumns(db, schemaV7Job{})
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, schemaV7Job{})
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add job trigger rules",
+		Up: func(db *gorm.DB) error {
+			return addColumns(db, schemaV8Job{})
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, schemaV8Job{})
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add job normalizers",
+		Up: func(db *gorm.DB) error {
+			return addColumns(db, schemaV9Job{})
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, schemaV9Job{})
+		},
+	},
+	{
+		Version: 10,
+		Name:    "add job text monitor mode",
+		Up: func(db *gorm.DB) error {
+			err := addColumns(db, schemaV10Job{})
+			if err != nil {
+				return err
+			}
+			// 页面文本远长于单个值, 存储值的字段改为长文本
+			err = modifyColumn(db, schemaV0Job{}, "old_value", longTextType(db))
+			if err == nil {
+				err = modifyColumn(db, schemaV1ValueChange{}, "value", longTextType(db))
+			}
+			if err == nil {
+				err = modifyColumn(db, schemaV1RunRecord{}, "value", longTextType(db))
+			}
+			return err
+		},
+		Down: func(db *gorm.DB) error {
+			err := narrowColumn(db, schemaV0Job{}, "old_value", 2048)
+			if err == nil {
+				err = narrowColumn(db, schemaV1ValueChange{}, "value", 2048)
+			}
+			if err == nil {
+				err = narrowColumn(db, schemaV1RunRecord{}, "value", 2048)
+			}
+			if err != nil {
+				return err
+			}
+			return dropColumns(db, schemaV10Job{})
+		},
+	},
+	{
+		Version: 11,
+		Name:    "add job hash monitor mode",
+		Up: func(db *gorm.DB) error {
+			return addColumns(db, schemaV11Job{})
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, schemaV11Job{})
+		},
+	},
+	{
+		Version: 12,
+		Name:    "add job conditional get toggle",
+		Up: func(db *gorm.DB) error {
+			return addColumns(db, schemaV12Job{})
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, schemaV12Job{})
+		},
+	},
+	{
+		Version: 13,
+		Name:    "add job overlap policy",
+		Up: func(db *gorm.DB) error {
+			return addColumns(db, schemaV13Job{})
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, schemaV13Job{})
+		},
+	},
+	{
+		Version: 14,
+		Name:    "add job ignore robots",
+		Up: func(db *gorm.DB) error {
+			return addColumns(db, schemaV14Job{})
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, schemaV14Job{})
+		},
+	},
+	{
+		Version: 15,
+		Name:    "add job trigger baseline",
+		Up: func(db *gorm.DB) error {
+			err := addColumns(db, schemaV15Job{})
+			if err != nil {
+				return err
+			}
+			return modifyColumn(db, schemaV15Job{}, "trigger_value", longTextType(db))
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, schemaV15Job{})
+		},
+	},
+	{
+		Version: 16,
+		Name:    "widen channel credentials",
+		Up: func(db *gorm.DB) error {
+			// 凭据加密后变长, 加宽对应字段
+			err := modifyColumn(db, schemaV1Channel{}, "url", "varchar(1024)")
+			if err == nil {
+				err = modifyColumn(db, schemaV1Channel{}, "headers", longTextType(db))
+			}
+			if err == nil {
+				err = modifyColumn(db, schemaV1Channel{}, "token", "varchar(512)")
+			}
+			if err == nil {
+				err = modifyColumn(db, schemaV1Channel{}, "secret", "varchar(512)")
+			}
+			return err
+		},
+		Down: func(db *gorm.DB) error {
+			err := narrowColumn(db, schemaV1Channel{}, "url", 512)
+			if err == nil {
+				err = narrowColumn(db, schemaV1Channel{}, "headers", 2048)
+			}
+			if err == nil {
+				err = narrowColumn(db, schemaV1Channel{}, "token", 256)
+			}
+			if err == nil {
+				err = narrowColumn(db, schemaV1Channel{}, "secret", 256)
+			}
+			return err
+		},
+	},
+}
+
+// renameColumn
+// 重命名列, 若旧列不存在或新列已存在则跳过
+func renameColumn(db *gorm.DB, value interface{}, oldName, newName string) error {
+	scope := db.NewScope(value)
+	tableName := scope.TableName()
+	if !scope.Dialect().HasColumn(tableName, oldName) || scope.Dialect().HasColumn(tableName, newName) {
+		return nil
+	}
+	return db.Exec(fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s",
+		scope.Quote(tableName), scope.Quote(oldName), scope.Quote(newName))).Error
+}
+
+// createTables
+// 按冻结的表结构建表, 表已存在时只补齐缺失的列及索引
+func createTables(db *gorm.DB, values ...interface{}) error {
+	for _, value := range values {
+		if db.HasTable(value) {
+			err := addColumns(db, value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := db.CreateTable(value).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createMissingTables
+// 按冻结的表结构创建不存在的表, 已存在的表不做修改
+func createMissingTables(db *gorm.DB, values ...interface{}) error {
+	for _, value := range values {
+		if db.HasTable(value) {
+			continue
+		}
+		err := db.CreateTable(value).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumns
+// 按冻结的表结构逐个添加缺失的列, 带 index 标签的列同时建立索引
+func addColumns(db *gorm.DB, value interface{}) error {
+	scope := db.NewScope(value)
+	tableName := scope.TableName()
+	for _, field := range scope.GetModelStruct().StructFields {
+		if !field.IsNormal {
+			continue
+		}
+		if !scope.Dialect().HasColumn(tableName, field.DBName) {
+			err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s",
+				scope.Quote(tableName), scope.Quote(field.DBName), scope.Dialect().DataTypeOf(field))).Error
+			if err != nil {
+				return err
+			}
+		}
+		if _, ok := field.TagSettingsGet("INDEX"); !ok {
+			continue
+		}
+		indexName := scope.Dialect().BuildKeyName("idx", tableName, field.DBName)
+		if scope.Dialect().HasIndex(tableName, indexName) {
+			continue
+		}
+		err := db.Model(value).AddIndex(indexName, field.DBName).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropColumns
+// 删除冻结的表结构中的所有列, 不存在的列跳过
+// sqlite3 旧版本不支持 DROP COLUMN, 此时重建该表
+func dropColumns(db *gorm.DB, value interface{}) error {
+	scope := db.NewScope(value)
+	tableName := scope.TableName()
+	var columns []string
+	for _, field := range scope.GetModelStruct().StructFields {
+		if field.IsNormal && scope.Dialect().HasColumn(tableName, field.DBName) {
+			columns = append(columns, field.DBName)
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	if db.Dialect().GetName() == config.DialectSqlite {
+		return rebuildSqliteTable(db, tableName, columns)
+	}
+	for _, column := range columns {
+		err := db.Model(value).DropColumn(column).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteColumn
+// PRAGMA table_info 返回的列信息
+type sqliteColumn struct {
+	name       string
+	columnType string
+	notNull    bool
+	defaultSQL sql.NullString
+	primaryKey bool
+}
+
+// rebuildSqliteTable
+// 以去掉指定列后的结构重建 sqlite 表并复制数据, 保留其余列的约束及不涉及被删除列的索引
+func rebuildSqliteTable(db *gorm.DB, tableName string, dropped []string) error {
+	drop := make(map[string]bool, len(dropped))
+	for _, column := range dropped {
+		drop[column] = true
+	}
+	scope := db.NewScope(nil)
+	var createSQL string
+	err := db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", tableName).Row().Scan(&createSQL)
+	if err != nil {
+		return err
+	}
+	columns, err := sqliteColumns(db, tableName)
+	if err != nil {
+		return err
+	}
+	// 唯一约束随表重建, 显式创建的索引在重建后按原语句恢复
+	uniques, indexSQLs, err := sqliteIndexes(db, tableName, drop)
+	if err != nil {
+		return err
+	}
+	// 自增主键需保留已分配的最大 ID, 避免已删除记录的 ID 被重新使用
+	autoIncrement := strings.Contains(strings.ToUpper(createSQL), "AUTOINCREMENT")
+	var sequence sql.NullInt64
+	if autoIncrement {
+		err = db.Raw("SELECT seq FROM sqlite_sequence WHERE name = ?", tableName).Row().Scan(&sequence)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+	var definitions, kept []string
+	for _, column := range columns {
+		if drop[column.name] {
+			continue
+		}
+		definition := scope.Quote(column.name) + " " + column.columnType
+		if column.primaryKey {
+			definition += " PRIMARY KEY"
+			if autoIncrement {
+				definition += " AUTOINCREMENT"
+			}
+		}
+		if column.notNull {
+			definition += " NOT NULL"
+		}
+		if column.defaultSQL.Valid {
+			definition += " DEFAULT " + column.defaultSQL.String
+		}
+		definitions = append(definitions, definition)
+		kept = append(kept, scope.Quote(column.name))
+	}
+	for _, unique := range uniques {
+		quoted := make([]string, 0, len(unique))
+		for _, column := range unique {
+			quoted = append(quoted, scope.Quote(column))
+		}
+		definitions = append(definitions, "UNIQUE ("+strings.Join(quoted, ", ")+")")
+	}
+	tempName := tableName + "__rebuild"
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE %s (%s)", scope.Quote(tempName), strings.Join(definitions, ", ")),
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s",
+			scope.Quote(tempName), strings.Join(kept, ", "), strings.Join(kept, ", "), scope.Quote(tableName)),
+		fmt.Sprintf("DROP TABLE %s", scope.Quote(tableName)),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", scope.Quote(tempName), scope.Quote(tableName)),
+	}
+	for _, statement := range append(statements, indexSQLs...) {
+		err = db.Exec(statement).Error
+		if err != nil {
+			return err
+		}
+	}
+	if sequence.Valid {
+		return db.Exec("UPDATE sqlite_sequence SET seq = ? WHERE name = ? AND seq < ?",
+			sequence.Int64, tableName, sequence.Int64).Error
+	}
+	return nil
+}
+
+// sqliteColumns
+// 查询 sqlite 表的所有列
+func sqliteColumns(db *gorm.DB, tableName string) ([]sqliteColumn, error) {
+	rows, err := db.Raw(fmt.Sprintf("PRAGMA table_info(%s)", db.NewScope(nil).Quote(tableName))).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []sqliteColumn
+	for rows.Next() {
+		var (
+			cid        int
+			column     sqliteColumn
+			notNull    int
+			primaryKey int
+		)
+		err = rows.Scan(&cid, &column.name, &column.columnType, &notNull, &column.defaultSQL, &primaryKey)
+		if err != nil {
+			return nil, err
+		}
+		column.notNull = notNull != 0
+		column.primaryKey = primaryKey != 0
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// sqliteIndexes
+// 查询 sqlite 表中不涉及被删除列的唯一约束的列及显式创建的索引的建立语句
+func sqliteIndexes(db *gorm.DB, tableName string, drop map[string]bool) ([][]string, []string, error) {
+	rows, err := db.Raw(fmt.Sprintf("PRAGMA index_list(%s)", db.NewScope(nil).Quote(tableName))).Rows()
+	if err != nil {
+		return nil, nil, err
+	}
+	origins := make(map[string]string)
+	var names []string
+	for rows.Next() {
+		var (
+			seq     int
+			name    string
+			unique  int
+			origin  string
+			partial int
+		)
+		err = rows.Scan(&seq, &name, &unique, &origin, &partial)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		origins[name] = origin
+		names = append(names, name)
+	}
+	rows.Close()
+	var uniques [][]string
+	var indexSQLs []string
+	for _, name := range names {
+		columns, err := sqliteIndexColumns(db, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		affected := false
+		for _, column := range columns {
+			affected = affected || drop[column]
+		}
+		if affected {
+			continue
+		}
+		switch origins[name] {
+		case "u":
+			uniques = append(uniques, columns)
+		case "c":
+			var indexSQL string
+			err = db.Raw("SELECT sql FROM sqlite_master WHERE type = 'index' AND name = ?", name).Row().Scan(&indexSQL)
+			if err != nil {
+				return nil, nil, err
+			}
+			indexSQLs = append(indexSQLs, indexSQL)
+		}
+	}
+	return uniques, indexSQLs, nil
+}
+
+// sqliteIndexColumns
+// 查询 sqlite 索引包含的列
+func sqliteIndexColumns(db *gorm.DB, indexName string) ([]string, error) {
+	rows, err := db.Raw(fmt.Sprintf("PRAGMA index_info(%s)", db.NewScope(nil).Quote(indexName))).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var (
+			seqno  int
+			cid    int
+			column string
+		)
+		err = rows.Scan(&seqno, &cid, &column)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// longTextType
+// 长文本字段的类型, MySQL 的 text 最长 64KB, 不足以存储整页文本, 使用 longtext
+func longTextType(db *gorm.DB) string {
+	if db.Dialect().GetName() == config.DialectMySQL {
+		return "longtext"
+	}
+	return "text"
+}
+
+// narrowColumn
+// 将长文本字段改回 varchar(size), 已有超出长度的值时拒绝执行, 避免截断数据
+func narrowColumn(db *gorm.DB, value interface{}, column string, size int) error {
+	if db.Dialect().GetName() == config.DialectSqlite {
+		return nil
+	}
+	scope := db.NewScope(value)
+	var count int
+	err := db.Raw(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE CHAR_LENGTH(%s) > ?",
+		scope.Quote(scope.TableName()), scope.Quote(column)), size).Row().Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf(config.MigrationValueTooLong, scope.TableName(), column, count, size)
+	}
+	return modifyColumn(db, value, column, fmt.Sprintf("varchar(%d)", size))
+}
+
+// modifyColumn
+// 修改字段类型, sqlite 不限制字段长度, 无需修改
+func modifyColumn(db *gorm.DB, value interface{}, column string, columnType string) error {
+	if db.Dialect().GetName() == config.DialectSqlite {
+		return nil
+	}
+	return db.Model(value).ModifyColumn(column, columnType).Error
+}
+
+// appliedMigrations
+// 查询已执行的迁移, 以版本号为键
+func appliedMigrations(db *gorm.DB) (map[uint]model.SchemaMigration, error) {
+	err := db.AutoMigrate(&model.SchemaMigration{}).Error
+	if err != nil {
+		return nil, err
+	}
+	var records []model.SchemaMigration
+	err = db.Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[uint]model.SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// MigrateUp
+// 按版本号顺序执行所有未执行的迁移, 返回本次执行的迁移数
+func MigrateUp(db *gorm.DB) (int, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, migration := range Migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		err = runMigration(db, migration, func(tx *gorm.DB) error {
+			err := migration.Up(tx)
+			if err != nil {
+				return err
+			}
+			return tx.Create(&model.SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// MigrateDown
+// 按版本号倒序回滚最近执行的 steps 个迁移, 返回本次回滚的迁移数
+func MigrateDown(db *gorm.DB, steps int) (int, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for i := len(Migrations) - 1; i >= 0 && count < steps; i-- {
+		migration := Migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		err = runMigration(db, migration, func(tx *gorm.DB) error {
+			err := migration.Down(tx)
+			if err != nil {
+				return err
+			}
+			return tx.Delete(&model.SchemaMigration{Version: migration.Version}).Error
+		})
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// runMigration
+// 在事务中执行迁移, 出错时回滚并附带迁移版本信息
+func runMigration(db *gorm.DB, migration Migration, run func(tx *gorm.DB) error) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	err := run(tx)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf(config.MigrationFail, migration.Version, migration.Name, err)
+	}
+	return tx.Commit().Error
+}
+
+// GetMigrationStates
+// 获取所有迁移的执行状态
+func GetMigrationStates(db *gorm.DB) ([]MigrationState, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, 0, len(Migrations))
+	for _, migration := range Migrations {
+		state := MigrationState{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			state.Applied = true
+			state.AppliedAt = &record.AppliedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
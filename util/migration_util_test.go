@@ -0,0 +1,143 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+
+	"surveillance-guy/model"
+)
+
+// rebuildRecord
+// 测试 sqlite 重建表使用的表结构
+type rebuildRecord struct {
+	gorm.Model
+	Name  string `gorm:"not null; unique"`
+	Code  string `gorm:"index"`
+	Extra string `gorm:"index"`
+	Note  string `gorm:"default:'none'"`
+}
+
+func (rebuildRecord) TableName() string { return "rebuild_records" }
+
+// rebuildRecordExtra
+// 待删除的列
+type rebuildRecordExtra struct {
+	Extra string
+}
+
+func (rebuildRecordExtra) TableName() string { return "rebuild_records" }
+
+func TestDropColumnsRebuildsSqliteTable(t *testing.T) {
+	db := openTestDataBase(t)
+	if err := db.CreateTable(&rebuildRecord{}).Error; err != nil {
+		t.Fatalf("creating the table failed: %v", err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		db.Create(&rebuildRecord{Name: name, Code: "code-" + name, Extra: "extra"})
+	}
+	// 删除最大 ID 的记录, 重建后该 ID 不应被重新使用
+	db.Unscoped().Delete(&rebuildRecord{}, "name = ?", "c")
+
+	if err := dropColumns(db, rebuildRecordExtra{}); err != nil {
+		t.Fatalf("dropColumns() error = %v", err)
+	}
+	if db.Dialect().HasColumn("rebuild_records", "extra") {
+		t.Error("the extra column still exists")
+	}
+	if db.Dialect().HasIndex("rebuild_records", "idx_rebuild_records_extra") {
+		t.Error("the index on the dropped column still exists")
+	}
+	if !db.Dialect().HasIndex("rebuild_records", "idx_rebuild_records_code") {
+		t.Error("the index on a kept column was not restored")
+	}
+
+	var records []rebuildRecord
+	db.Select("id, name, code, note").Order("id").Find(&records)
+	if len(records) != 2 || records[0].Name != "a" || records[1].Code != "code-b" {
+		t.Errorf("records after the rebuild = %+v, want a and b kept", records)
+	}
+	type kept struct {
+		gorm.Model
+		Name string
+		Note string `gorm:"default:'none'"`
+	}
+	next := kept{Name: "d"}
+	if err := db.Table("rebuild_records").Create(&next).Error; err != nil {
+		t.Fatalf("inserting after the rebuild failed: %v", err)
+	}
+	if next.ID != 4 {
+		t.Errorf("next id = %d, want 4", next.ID)
+	}
+	var note string
+	db.Table("rebuild_records").Where("id = ?", next.ID).Select("note").Row().Scan(&note)
+	if note != "none" {
+		t.Errorf("note = %q, want the column default kept", note)
+	}
+	// 唯一约束随表重建
+	if err := db.LogMode(false).Table("rebuild_records").Create(&kept{Name: "a"}).Error; err == nil {
+		t.Error("inserting a duplicate name succeeded, want the unique constraint kept")
+	}
+}
+
+func TestMigrateDownKeepsBaselineTables(t *testing.T) {
+	db := openTestDataBase(t)
+	// 迁移机制引入前的数据库
+	if err := createTables(db, schemaV0Account{}, schemaV0Job{}, schemaV0Template{}); err != nil {
+		t.Fatalf("creating the baseline tables failed: %v", err)
+	}
+	db.Create(&schemaV0Account{Email: "a@example.com", Password: "secret"})
+	db.Create(&schemaV0Job{Name: "job", Cron: "@every 1h", Email: "a@example.com", OldValue: "42"})
+	db.Create(&schemaV0Template{Name: "template", Corn: "@daily"})
+
+	applied, err := MigrateUp(db)
+	if err != nil || applied != len(Migrations) {
+		t.Fatalf("MigrateUp() = %d, %v, want %d", applied, err, len(Migrations))
+	}
+	var template model.Template
+	db.First(&template)
+	if template.Cron != "@daily" {
+		t.Errorf("template cron = %q, want the corn column renamed with its value", template.Cron)
+	}
+
+	rolledBack, err := MigrateDown(db, len(Migrations))
+	if err != nil || rolledBack != len(Migrations) {
+		t.Fatalf("MigrateDown() = %d, %v, want %d", rolledBack, err, len(Migrations))
+	}
+	for _, table := range []string{"run_records", "value_changes", "channels", "recipient_groups"} {
+		if db.HasTable(table) {
+			t.Errorf("table %s still exists after rolling back", table)
+		}
+	}
+	for _, column := range []string{"pattern_type", "channel_ids", "old_value", "trigger_value"} {
+		if has := db.Dialect().HasColumn("jobs", column); has != (column == "old_value") {
+			t.Errorf("jobs.%s exists = %v after rolling back", column, has)
+		}
+	}
+	if !db.Dialect().HasColumn("templates", "corn") || db.Dialect().HasColumn("templates", "cron") {
+		t.Error("templates.cron was not renamed back to corn")
+	}
+	var job schemaV0Job
+	db.First(&job)
+	var oldTemplate schemaV0Template
+	db.First(&oldTemplate)
+	var accounts int
+	db.Model(&schemaV0Account{}).Count(&accounts)
+	if job.Name != "job" || job.OldValue != "42" || oldTemplate.Corn != "@daily" || accounts != 1 {
+		t.Errorf("baseline data after rolling back: job = %+v, template = %+v, %d accounts", job, oldTemplate, accounts)
+	}
+
+	// 回滚后可重新迁移
+	if applied, err = MigrateUp(db); err != nil || applied != len(Migrations) {
+		t.Fatalf("MigrateUp() after rolling back = %d, %v, want %d", applied, err, len(Migrations))
+	}
+	states, err := GetMigrationStates(db)
+	if err != nil {
+		t.Fatalf("GetMigrationStates() error = %v", err)
+	}
+	for _, state := range states {
+		if !state.Applied {
+			t.Errorf("migration %d %s is not applied", state.Version, state.Name)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// ValidateMonitorMode
+// 校验任务的监控方式、监控区域、忽略的行及下载大小限制
+func ValidateMonitorMode(job model.Job) error {
+	switch job.MonitorMode {
+	case "", model.MonitorValue, model.MonitorText:
+	case model.MonitorHash:
+		if job.FetchMode == model.FetchBrowser {
+			return errors.New(config.HashBrowserUnsupported)
+		}
+	default:
+		return fmt.Errorf(config.MonitorModeNotFound, job.MonitorMode)
+	}
+	if job.MaxDownloadSize < 0 {
+		return fmt.Errorf(config.MaxDownloadSizeInvalid, job.MaxDownloadSize)
+	}
+	if strings.TrimSpace(job.Region) != "" {
+		if _, err := cascadia.Compile(job.Region); err != nil {
+			return fmt.Errorf(config.RegionInvalid, job.Region, err)
+		}
+	}
+	_, err := ParseIgnoreLines(job.IgnoreLines)
+	return err
+}
+
+// ExtractJobTargets
+// 按任务的监控方式从页面中提取结果
+// value 方式按抓取规则提取, 非多值匹配时只有一项; text 方式提取页面或监控区域的可读文本, 并去除忽略的行
+// hash 方式以下载时计算的内容摘要作为结果
+func ExtractJobTargets(job model.Job, page FetchResult) ([]string, error) {
+	if job.MonitorMode == model.MonitorHash {
+		return []string{page.Hash}, nil
+	}
+	content := page.Body
+	if job.MonitorMode != model.MonitorText {
+		if job.MultiMatch {
+			return ExtractTargets(content, job.PatternType, job.Pattern)
+		}
+		target, err := ExtractTarget(content, job.PatternType, job.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return []string{target}, nil
+	}
+	text, err := ExtractPageText(content, job.Region)
+	if err != nil {
+		return nil, err
+	}
+	ignorePatterns, err := ParseIgnoreLines(job.IgnoreLines)
+	if err != nil {
+		return nil, err
+	}
+	return []string{removeIgnoredLines(text, ignorePatterns)}, nil
+}
+
+// ExtractPageText
+// 提取页面的可读文本, region 不为空时只提取匹配该 CSS 选择器的所有区域, 各区域之间空一行
+func ExtractPageText(content []byte, region string) (string, error) {
+	if strings.TrimSpace(region) == "" {
+		return HtmlToText(content), nil
+	}
+	document, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	selection := document.Find(region)
+	if selection.Length() == 0 {
+		return "", ErrTargetNotMatch
+	}
+	var texts []string
+	selection.Each(func(_ int, item *goquery.Selection) {
+		outer, err := goquery.OuterHtml(item)
+		if err == nil {
+			texts = append(texts, HtmlToText([]byte(outer)))
+		}
+	})
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// ParseIgnoreLines
+// 解析 JSON 数组形式的忽略行正则表达式
+func ParseIgnoreLines(ignoreLines string) ([]*regexp.Regexp, error) {
+	if strings.TrimSpace(ignoreLines) == "" {
+		return nil, nil
+	}
+	var patterns []string
+	err := json.Unmarshal([]byte(ignoreLines), &patterns)
+	if err != nil {
+		return nil, fmt.Errorf(config.IgnoreLinesInvalid, err)
+	}
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		res, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf(config.IgnoreLinesInvalid, err)
+		}
+		compiled = append(compiled, res)
+	}
+	return compiled, nil
+}
+
+// removeIgnoredLines
+// 删除匹配任一正则表达式的行
+func removeIgnoredLines(text string, patterns []*regexp.Regexp) string {
+	if len(patterns) == 0 {
+		return text
+	}
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		ignored := false
+		for _, pattern := range patterns {
+			if pattern.MatchString(line) {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// JobMaxDownloadSize
+// 获取任务允许下载的最大字节数, 任务未设置时使用全局配置
+func JobMaxDownloadSize(job model.Job) int64 {
+	if job.MaxDownloadSize > 0 {
+		return job.MaxDownloadSize
+	}
+	return config.MaxDownloadSize
+}
+
+// HashResponseBody
+// 边读取响应体边计算 SHA-256 摘要及大小, 不在内存中保留内容, 超过 maxSize 时返回错误
+func HashResponseBody(response *http.Response, maxSize int64) (string, int64, error) {
+	if response.ContentLength > maxSize {
+		return "", response.ContentLength, fmt.Errorf(config.MaxDownloadSizeExceeded, maxSize)
+	}
+	hash := sha256.New()
+	// 多读一个字节用于判断是否超出限制, 响应头未声明长度或声明有误时同样生效
+	size, err := io.Copy(hash, io.LimitReader(response.Body, maxSize+1))
+	if err != nil {
+		return "", size, err
+	}
+	if size > maxSize {
+		return "", size, fmt.Errorf(config.MaxDownloadSizeExceeded, maxSize)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// validatorsUnchanged
+// 判断成功响应的 ETag 或 Last-Modified 是否与任务上次记录的相同, 优先比较 ETag
+func validatorsUnchanged(job model.Job, response *http.Response) bool {
+	if response.StatusCode >= http.StatusMultipleChoices {
+		return false
+	}
+	if etag := response.Header.Get("ETag"); etag != "" && job.ETag != "" {
+		return etag == job.ETag
+	}
+	lastModified := response.Header.Get("Last-Modified")
+	return lastModified != "" && lastModified == job.LastModified
+}
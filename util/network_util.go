@@ -0,0 +1,298 @@
+package util
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+var (
+	// proxyCounters 每个代理池一个计数器, 用于轮流选取代理
+	proxyCounters sync.Map
+	// rootCAs 缓存加载了额外 CA 证书的证书池
+	rootCAs     *x509.CertPool
+	rootCAsErr  error
+	rootCAsOnce sync.Once
+)
+
+// ProxyDirect 任务指定该值时不使用全局代理
+var ProxyDirect = "direct"
+
+// outboundTransport
+// 在每次请求(包括重定向)前校验出站访问策略
+type outboundTransport struct {
+	base    *http.Transport
+	proxied bool
+}
+
+func (transport outboundTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	err := CheckOutboundUrl(request.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	// 直连时由 DialContext 校验实际连接的地址, 经代理时在此解析校验
+	// 本地无法解析的域名交由代理解析, 只拒绝解析到受限地址的域名
+	if transport.proxied {
+		_, err = ResolveOutboundHost(request.Context(), request.URL.Hostname())
+		var dnsErr *net.DNSError
+		if err != nil && !errors.As(err, &dnsErr) {
+			return nil, err
+		}
+	}
+	return transport.base.RoundTrip(request)
+}
+
+// NewFetchClient
+// 按任务及全局配置创建抓取页面所用的 Client, 包含代理、TLS 校验及出站访问策略
+func NewFetchClient(job model.Job, jar http.CookieJar, checkRedirect func(request *http.Request, via []*http.Request) error) (*http.Client, error) {
+	transport, proxied, err := newFetchTransport(job)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport:     outboundTransport{base: transport, proxied: proxied},
+		Timeout:       time.Duration(config.Timeout) * time.Second,
+		Jar:           jar,
+		CheckRedirect: checkRedirect,
+	}, nil
+}
+
+// newFetchTransport
+// 创建带代理及 TLS 配置的 Transport, 返回是否经代理访问
+func newFetchTransport(job model.Job) (*http.Transport, bool, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.InsecureSkipVerify || job.SkipTLSVerify,
+	}
+	pool, err := loadRootCAs()
+	if err != nil {
+		return nil, false, err
+	}
+	tlsConfig.RootCAs = pool
+	transport := &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	proxyUrl, err := PickProxy(job)
+	if err != nil {
+		return nil, false, err
+	}
+	dialer := &net.Dialer{Timeout: time.Duration(config.Timeout) * time.Second}
+	if proxyUrl != nil {
+		// 经代理访问时由代理解析目标地址, 出站策略在发起请求前校验
+		transport.Proxy = http.ProxyURL(proxyUrl)
+		transport.DialContext = dialer.DialContext
+	} else {
+		transport.DialContext = outboundDialContext(dialer)
+	}
+	return transport, proxyUrl != nil, nil
+}
+
+// PickProxy
+// 选取任务使用的代理, 任务未指定时使用全局代理, 代理池中轮流选取, 返回 nil 表示直连
+func PickProxy(job model.Job) (*url.URL, error) {
+	pool := config.Proxy
+	if job.Proxy != "" {
+		pool = job.Proxy
+	}
+	if strings.TrimSpace(pool) == ProxyDirect {
+		return nil, nil
+	}
+	proxies, err := config.ParseProxyList(pool)
+	if err != nil || len(proxies) == 0 {
+		return nil, err
+	}
+	counter, _ := proxyCounters.LoadOrStore(pool, new(uint64))
+	index := atomic.AddUint64(counter.(*uint64), 1) - 1
+	return proxies[index%uint64(len(proxies))], nil
+}
+
+// ValidateJobProxy
+// 校验任务的代理配置
+func ValidateJobProxy(proxy string) error {
+	if strings.TrimSpace(proxy) == ProxyDirect {
+		return nil
+	}
+	_, err := config.ParseProxyList(proxy)
+	return err
+}
+
+// loadRootCAs
+// 加载系统证书及配置的额外 CA 证书, 未配置时返回 nil 使用系统证书
+func loadRootCAs() (*x509.CertPool, error) {
+	rootCAsOnce.Do(func() {
+		if config.CABundle == "" {
+			return
+		}
+		content, err := os.ReadFile(config.CABundle)
+		if err != nil {
+			rootCAsErr = err
+			return
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(content) {
+			rootCAsErr = fmt.Errorf(config.CABundleInvalid, config.CABundle)
+			return
+		}
+		rootCAs = pool
+	})
+	return rootCAs, rootCAsErr
+}
+
+// CheckOutboundUrl
+// 校验 URL 的协议及主机是否被出站访问策略允许, 不做域名解析
+func CheckOutboundUrl(rawUrl string) error {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf(config.OutboundSchemeDeny, parsed.Scheme)
+	}
+	return CheckOutboundHost(parsed.Hostname())
+}
+
+// CheckOutboundHost
+// 校验主机名是否被出站访问策略允许, 主机为 IP 时同时校验地址, 不做域名解析
+func CheckOutboundHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if matchHostRules(host, config.DenyHosts) {
+		return fmt.Errorf(config.OutboundHostDeny, host)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return checkOutboundIP(host, ip)
+	}
+	// 允许列表中含有 IP 或 CIDR 时, 域名需在解析后按地址校验
+	if len(config.AllowHosts) > 0 && !matchHostRules(host, config.AllowHosts) && !hasIPRules(config.AllowHosts) {
+		return fmt.Errorf(config.OutboundHostDeny, host)
+	}
+	return nil
+}
+
+// ResolveOutboundHost
+// 解析主机名并校验所有解析结果, 经代理访问时用于发起请求前的校验
+func ResolveOutboundHost(ctx context.Context, host string) ([]net.IP, error) {
+	err := CheckOutboundHost(host)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(addresses))
+	for _, address := range addresses {
+		err = checkOutboundIP(host, address.IP)
+		if err != nil {
+			return nil, err
+		}
+		ips = append(ips, address.IP)
+	}
+	return ips, nil
+}
+
+// outboundDialContext
+// 直连时先解析并校验目标地址, 再连接校验通过的地址, 避免 DNS 重绑定绕过策略
+func outboundDialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := ResolveOutboundHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var conn net.Conn
+		for _, ip := range ips {
+			conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
+
+// checkOutboundIP
+// 校验地址是否被出站访问策略允许, 显式允许的主机或地址不受内网限制
+func checkOutboundIP(host string, ip net.IP) error {
+	if matchIPRules(ip, config.DenyHosts) {
+		return fmt.Errorf(config.OutboundAddressDeny, ip, host)
+	}
+	allowed := matchHostRules(host, config.AllowHosts) || matchIPRules(ip, config.AllowHosts)
+	if len(config.AllowHosts) > 0 && !allowed {
+		return fmt.Errorf(config.OutboundAddressDeny, ip, host)
+	}
+	if allowed || !config.DenyPrivateNetworks {
+		return nil
+	}
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf(config.OutboundAddressDeny, ip, host)
+	}
+	return nil
+}
+
+// matchHostRules
+// 判断主机名是否匹配规则, 支持完整主机名及 *.example.com 形式的子域名通配
+func matchHostRules(host string, rules []string) bool {
+	for _, rule := range rules {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		if rule == host {
+			return true
+		}
+		if strings.HasPrefix(rule, "*.") && strings.HasSuffix(host, rule[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasIPRules
+// 判断规则中是否含有 IP 或 CIDR
+func hasIPRules(rules []string) bool {
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if _, _, err := net.ParseCIDR(rule); err == nil || net.ParseIP(rule) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// matchIPRules
+// 判断地址是否匹配规则中的 IP 或 CIDR
+func matchIPRules(ip net.IP, rules []string) bool {
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if _, network, err := net.ParseCIDR(rule); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if ruleIP := net.ParseIP(rule); ruleIP != nil && ruleIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// NormalizeTrace
+// 规范化过程中某一步骤处理后的值, 供测试接口展示
+type NormalizeTrace struct {
+	Step   string   `json:"step"`   // 步骤类型, raw 表示原始值
+	Values []string `json:"values"` // 该步骤处理后的值, 非多值匹配时只有一项
+}
+
+// spacePattern 连续的空白, 不含换行
+var spacePattern = regexp.MustCompile(`[^\S\n]+`)
+
+// ParseNormalizeSteps
+// 解析 JSON 数组形式的规范化步骤
+func ParseNormalizeSteps(steps string) ([]model.NormalizeStep, error) {
+	var parsed []model.NormalizeStep
+	if strings.TrimSpace(steps) == "" {
+		return parsed, nil
+	}
+	err := json.Unmarshal([]byte(steps), &parsed)
+	if err != nil {
+		return nil, fmt.Errorf(config.NormalizeStepsInvalid, err)
+	}
+	return parsed, nil
+}
+
+// ValidateNormalizeSteps
+// 校验规范化步骤的类型及正则表达式
+func ValidateNormalizeSteps(steps string) error {
+	parsed, err := ParseNormalizeSteps(steps)
+	if err != nil {
+		return err
+	}
+	for i, step := range parsed {
+		switch step.Type {
+		case model.NormalizeTrim, model.NormalizeCollapseSpace, model.NormalizeHtmlUnescape, model.NormalizeStripTags,
+			model.NormalizeLowercase, model.NormalizeExtractNumber:
+		case model.NormalizeRegexReplace, model.NormalizeRemoveLines:
+			if step.Pattern == "" {
+				return fmt.Errorf(config.NormalizePatternEmpty, i+1, step.Type)
+			}
+			if _, err = regexp.Compile(step.Pattern); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf(config.NormalizeTypeInvalid, i+1, step.Type)
+		}
+	}
+	return nil
+}
+
+// NormalizeTargets
+// 依次以规范化步骤处理每个抓取结果, 返回处理后的结果及每一步之后的值
+func NormalizeTargets(targets []string, steps string, locale string) ([]string, []NormalizeTrace, error) {
+	parsed, err := ParseNormalizeSteps(steps)
+	if err != nil {
+		return nil, nil, err
+	}
+	values := append([]string(nil), targets...)
+	traces := []NormalizeTrace{{Step: model.NormalizeRaw, Values: append([]string(nil), values...)}}
+	for i, step := range parsed {
+		for j := range values {
+			values[j], err = normalizeValue(values[j], step, locale)
+			if err != nil {
+				return nil, traces, fmt.Errorf(config.NormalizeStepFail, i+1, step.Type, err)
+			}
+		}
+		traces = append(traces, NormalizeTrace{Step: step.Type, Values: append([]string(nil), values...)})
+	}
+	return values, traces, nil
+}
+
+// normalizeValue
+// 以单个规范化步骤处理值
+func normalizeValue(value string, step model.NormalizeStep, locale string) (string, error) {
+	switch step.Type {
+	case model.NormalizeTrim:
+		return strings.TrimSpace(value), nil
+	case model.NormalizeCollapseSpace:
+		return spacePattern.ReplaceAllString(value, " "), nil
+	case model.NormalizeHtmlUnescape:
+		return html.UnescapeString(value), nil
+	case model.NormalizeStripTags:
+		return HtmlToText([]byte(value)), nil
+	case model.NormalizeLowercase:
+		return strings.ToLower(value), nil
+	case model.NormalizeRegexReplace, model.NormalizeRemoveLines:
+		pattern, err := regexp.Compile(step.Pattern)
+		if err != nil {
+			return "", err
+		}
+		if step.Type == model.NormalizeRegexReplace {
+			return pattern.ReplaceAllString(value, step.Replacement), nil
+		}
+		var lines []string
+		for _, line := range strings.Split(value, "\n") {
+			if !pattern.MatchString(line) {
+				lines = append(lines, line)
+			}
+		}
+		return strings.Join(lines, "\n"), nil
+	case model.NormalizeExtractNumber:
+		number, err := ParseNumber(value, locale)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(number, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf(config.NormalizeTypeInvalid, 0, step.Type)
+}
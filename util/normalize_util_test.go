@@ -0,0 +1,96 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	"surveillance-guy/model"
+)
+
+func TestNormalizeTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		steps   string
+		locale  string
+		want    []string
+	}{
+		{"no steps", []string{" a "}, "", "", []string{" a "}},
+		{"trim", []string{"  a \n"}, `[{"type": "trim"}]`, "", []string{"a"}},
+		{"collapse whitespace keeps newlines", []string{"a \t b\n  c"}, `[{"type": "collapse_whitespace"}]`, "", []string{"a b\n c"}},
+		{"html unescape", []string{"Tom &amp; Jerry &lt;3"}, `[{"type": "html_unescape"}]`, "", []string{"Tom & Jerry <3"}},
+		{"strip tags", []string{"<b>Price</b>: <i>42</i>"}, `[{"type": "strip_tags"}]`, "", []string{"Price: 42"}},
+		{"lowercase", []string{"In Stock"}, `[{"type": "lowercase"}]`, "", []string{"in stock"}},
+		{"regex replace", []string{"Updated 10:42, 3 left"}, `[{"type": "regex_replace", "pattern": "\\d+:\\d+", "replacement": "<time>"}]`, "", []string{"Updated <time>, 3 left"}},
+		{"remove lines", []string{"price 42\nviews 1024\nstock 3"}, `[{"type": "remove_lines", "pattern": "^views"}]`, "", []string{"price 42\nstock 3"}},
+		{"extract number", []string{"Price: 1.234,50 €"}, `[{"type": "extract_number"}]`, "", []string{"1234.5"}},
+		{"extract number with locale", []string{"1,5"}, `[{"type": "extract_number"}]`, "en", []string{"15"}},
+		{
+			"steps run in order on every target",
+			[]string{"  <b>A&amp;B</b>  ", " <b>C</b>"},
+			`[{"type": "strip_tags"}, {"type": "html_unescape"}, {"type": "trim"}, {"type": "lowercase"}]`,
+			"",
+			[]string{"a&b", "c"},
+		},
+	}
+	for _, test := range tests {
+		got, _, err := NormalizeTargets(test.targets, test.steps, test.locale)
+		if err != nil {
+			t.Errorf("%s: NormalizeTargets() error = %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: NormalizeTargets() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNormalizeTargetsTraces(t *testing.T) {
+	targets := []string{" Sold OUT "}
+	got, traces, err := NormalizeTargets(targets, `[{"type": "trim"}, {"type": "lowercase"}]`, "")
+	if err != nil {
+		t.Fatalf("NormalizeTargets() error = %v", err)
+	}
+	want := []NormalizeTrace{
+		{Step: model.NormalizeRaw, Values: []string{" Sold OUT "}},
+		{Step: model.NormalizeTrim, Values: []string{"Sold OUT"}},
+		{Step: model.NormalizeLowercase, Values: []string{"sold out"}},
+	}
+	if !reflect.DeepEqual(traces, want) {
+		t.Errorf("traces = %+v, want %+v", traces, want)
+	}
+	if targets[0] != " Sold OUT " || got[0] != "sold out" {
+		t.Errorf("targets = %q, got = %q, want the input left unchanged", targets, got)
+	}
+
+	// 出错时返回出错之前的步骤, 便于定位
+	_, traces, err = NormalizeTargets([]string{" Sold out "}, `[{"type": "trim"}, {"type": "extract_number"}]`, "")
+	if err == nil {
+		t.Fatal("NormalizeTargets() error = nil, want extract_number to fail")
+	}
+	if len(traces) != 2 || traces[1].Values[0] != "Sold out" {
+		t.Errorf("traces on error = %+v, want the raw value and the trim step", traces)
+	}
+}
+
+func TestValidateNormalizeSteps(t *testing.T) {
+	tests := []struct {
+		steps string
+		valid bool
+	}{
+		{"", true},
+		{`[]`, true},
+		{`[{"type": "trim"}, {"type": "extract_number"}]`, true},
+		{`[{"type": "regex_replace", "pattern": "\\s+", "replacement": " "}]`, true},
+		{`[{"type": "regex_replace"}]`, false},
+		{`[{"type": "remove_lines", "pattern": "("}]`, false},
+		{`[{"type": "uppercase"}]`, false},
+		{`{"type": "trim"}`, false},
+	}
+	for _, test := range tests {
+		err := ValidateNormalizeSteps(test.steps)
+		if (err == nil) != test.valid {
+			t.Errorf("ValidateNormalizeSteps(%s) error = %v, want valid %v", test.steps, err, test.valid)
+		}
+	}
+}
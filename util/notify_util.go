@@ -0,0 +1,433 @@
+package util
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// NotifyMessage
+// 通知消息, Content 为 html 格式
+type NotifyMessage struct {
+	Subject  string // 通知标题
+	Content  string // 通知内容
+	JobName  string // 任务名称
+	JobUrl   string // 任务监控的页面 URL
+	OldValue string // 变动前的值
+	NewValue string // 抓取到的新值
+}
+
+// Text
+// 将通知消息转换为纯文本, 供 IM 机器人类渠道使用
+func (message NotifyMessage) Text() string {
+	return message.Subject + "\n\n" + HtmlToText([]byte(message.Content))
+}
+
+// Notifier
+// 通知渠道
+type Notifier interface {
+	Notify(message NotifyMessage) error
+}
+
+// NewNotifier
+// 根据通知渠道配置创建对应的通知渠道
+func NewNotifier(channel model.Channel) (Notifier, error) {
+	switch channel.Type {
+	case model.ChannelWebhook:
+		return WebhookNotifier{Channel: channel}, nil
+	case model.ChannelSlack:
+		return SlackNotifier{Url: channel.Url}, nil
+	case model.ChannelTelegram:
+		return TelegramNotifier{Url: channel.Url, Token: channel.Token, ChatID: channel.ChatID}, nil
+	case model.ChannelDingTalk:
+		return DingTalkNotifier{Url: channel.Url, Secret: channel.Secret}, nil
+	case model.ChannelWeCom:
+		return WeComNotifier{Url: channel.Url}, nil
+	case model.ChannelFeishu:
+		return FeishuNotifier{Url: channel.Url, Secret: channel.Secret}, nil
+	default:
+		return nil, fmt.Errorf(config.ChannelTypeNotFound, channel.Type)
+	}
+}
+
+// channelCredentials
+// 通知渠道中加密存储并在列表中隐藏的字段: token、加签密钥、请求头, 以及带有 access token 的机器人 webhook 地址
+func channelCredentials(channel *model.Channel) []*string {
+	fields := []*string{&channel.Token, &channel.Secret, &channel.Headers}
+	switch channel.Type {
+	case model.ChannelSlack, model.ChannelDingTalk, model.ChannelWeCom, model.ChannelFeishu:
+		fields = append(fields, &channel.Url)
+	}
+	return fields
+}
+
+// SealChannel
+// 加密通知渠道的凭据字段后用于存储
+func SealChannel(channel model.Channel) (model.Channel, error) {
+	for _, field := range channelCredentials(&channel) {
+		encrypted, err := EncryptSecret(*field)
+		if err != nil {
+			return channel, err
+		}
+		*field = encrypted
+	}
+	return channel, nil
+}
+
+// OpenChannel
+// 解密数据库中通知渠道的凭据字段, 加密存储之前保存的明文原样使用
+func OpenChannel(channel model.Channel) (model.Channel, error) {
+	for _, field := range channelCredentials(&channel) {
+		if !strings.HasPrefix(*field, encryptedPrefix) {
+			continue
+		}
+		plain, err := DecryptSecret(*field)
+		if err != nil {
+			return channel, err
+		}
+		*field = plain
+	}
+	return channel, nil
+}
+
+// MaskChannel
+// 以掩码替换通知渠道的凭据字段, 用于返回给前端
+func MaskChannel(channel model.Channel) model.Channel {
+	for _, field := range channelCredentials(&channel) {
+		if *field != "" {
+			*field = config.PasswordEncoded
+		}
+	}
+	return channel
+}
+
+// RestoreMaskedChannel
+// 请求中仍为掩码的凭据字段沿用已解密的原配置 stored 中的值
+func RestoreMaskedChannel(channel model.Channel, stored model.Channel) model.Channel {
+	pairs := [][2]*string{
+		{&channel.Token, &stored.Token},
+		{&channel.Secret, &stored.Secret},
+		{&channel.Headers, &stored.Headers},
+		{&channel.Url, &stored.Url},
+	}
+	for _, pair := range pairs {
+		if *pair[0] == config.PasswordEncoded {
+			*pair[0] = *pair[1]
+		}
+	}
+	return channel
+}
+
+// NotifyJob
+// 向任务的邮件收件人及绑定的所有通知渠道发送通知, 单个渠道失败不影响其余渠道, 返回所有失败原因
+func NotifyJob(job model.Job, message NotifyMessage) error {
+	var errs []error
+	emailNotifier, err := NewJobEmailNotifier(job)
+	if err != nil {
+		errs = append(errs, err)
+	} else if emailNotifier != nil {
+		errs = append(errs, emailNotifier.Notify(message))
+	}
+	channelIDs, err := ParseIDList(job.ChannelIDs)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for _, channelID := range channelIDs {
+		var channel model.Channel
+		err = config.DataBase.First(&channel, channelID).Error
+		if err == nil {
+			channel, err = OpenChannel(channel)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf(config.ChannelNotifyFail, channelID, err.Error()))
+			continue
+		}
+		if channel.Status == model.ChannelDisabled {
+			continue
+		}
+		notifier, err := NewNotifier(channel)
+		if err == nil {
+			err = notifier.Notify(message)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf(config.ChannelNotifyFail, channelID, err.Error()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseIDList
+// 解析以逗号分隔的 ID 列表
+func ParseIDList(ids string) ([]uint, error) {
+	var res []uint
+	for _, item := range strings.Split(ids, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(item, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf(config.IDListInvalid, ids)
+		}
+		res = append(res, uint(id))
+	}
+	return res, nil
+}
+
+// WebhookNotifier
+// 通用 webhook, 请求方法、请求头及请求体模板均可配置
+// 请求体模板可使用 NotifyMessage 的字段及 Text 方法, json 函数可将值转义为 JSON 字符串, 如 {"text": {{json .Text}}}
+type WebhookNotifier struct {
+	Channel model.Channel
+}
+
+func (notifier WebhookNotifier) Notify(message NotifyMessage) error {
+	method := notifier.Channel.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	headers := map[string]string{}
+	if notifier.Channel.Headers != "" {
+		err := json.Unmarshal([]byte(notifier.Channel.Headers), &headers)
+		if err != nil {
+			return err
+		}
+	}
+	bodyTemplate := notifier.Channel.Body
+	if bodyTemplate == "" {
+		bodyTemplate = config.WebhookDefaultBody
+	}
+	body, err := RenderWebhookBody(bodyTemplate, message)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(strings.ToUpper(method), notifier.Channel.Url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	_, err = doNotifyRequest(request)
+	return err
+}
+
+// RenderWebhookBody
+// 渲染通用 webhook 请求体模板
+func RenderWebhookBody(bodyTemplate string, message NotifyMessage) (string, error) {
+	tmpl, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			res, err := json.Marshal(value)
+			return string(res), err
+		},
+	}).Parse(bodyTemplate)
+	if err != nil {
+		return "", err
+	}
+	var body bytes.Buffer
+	err = tmpl.Execute(&body, message)
+	if err != nil {
+		return "", err
+	}
+	return body.String(), nil
+}
+
+// SlackNotifier
+// Slack / Mattermost 兼容的 incoming webhook
+type SlackNotifier struct {
+	Url string
+}
+
+func (notifier SlackNotifier) Notify(message NotifyMessage) error {
+	_, err := postNotifyJSON(notifier.Url, map[string]interface{}{
+		"text": message.Text(),
+	})
+	return err
+}
+
+// TelegramNotifier
+// Telegram 机器人, Url 为空时使用官方 Bot API 地址
+type TelegramNotifier struct {
+	Url    string
+	Token  string
+	ChatID string
+}
+
+func (notifier TelegramNotifier) Notify(message NotifyMessage) error {
+	apiUrl := notifier.Url
+	if apiUrl == "" {
+		apiUrl = config.TelegramApiUrl
+	}
+	apiUrl = strings.TrimRight(apiUrl, "/") + "/bot" + notifier.Token + "/sendMessage"
+	res, err := postNotifyJSON(apiUrl, map[string]interface{}{
+		"chat_id": notifier.ChatID,
+		"text":    message.Text(),
+	})
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Ok          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if json.Unmarshal(res, &result) == nil && !result.Ok {
+		return fmt.Errorf(config.ChannelRespondError, result.Description)
+	}
+	return nil
+}
+
+// DingTalkNotifier
+// 钉钉群机器人, 配置了 Secret 时按加签方式发送
+type DingTalkNotifier struct {
+	Url    string
+	Secret string
+}
+
+func (notifier DingTalkNotifier) Notify(message NotifyMessage) error {
+	webhookUrl := notifier.Url
+	if notifier.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		sign := signHmacSHA256(notifier.Secret, timestamp+"\n"+notifier.Secret)
+		webhookUrl = appendUrlQuery(webhookUrl, url.Values{"timestamp": {timestamp}, "sign": {sign}})
+	}
+	res, err := postNotifyJSON(webhookUrl, map[string]interface{}{
+		"msgtype": "text",
+		"text":    map[string]string{"content": message.Text()},
+	})
+	if err != nil {
+		return err
+	}
+	return checkRobotErrCode(res)
+}
+
+// WeComNotifier
+// 企业微信群机器人
+type WeComNotifier struct {
+	Url string
+}
+
+func (notifier WeComNotifier) Notify(message NotifyMessage) error {
+	res, err := postNotifyJSON(notifier.Url, map[string]interface{}{
+		"msgtype": "text",
+		"text":    map[string]string{"content": message.Text()},
+	})
+	if err != nil {
+		return err
+	}
+	return checkRobotErrCode(res)
+}
+
+// FeishuNotifier
+// 飞书群机器人, 配置了 Secret 时按签名校验方式发送
+type FeishuNotifier struct {
+	Url    string
+	Secret string
+}
+
+func (notifier FeishuNotifier) Notify(message NotifyMessage) error {
+	payload := map[string]interface{}{
+		"msg_type": "text",
+		"content":  map[string]string{"text": message.Text()},
+	}
+	if notifier.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		payload["timestamp"] = timestamp
+		payload["sign"] = signHmacSHA256(timestamp+"\n"+notifier.Secret, "")
+	}
+	res, err := postNotifyJSON(notifier.Url, payload)
+	if err != nil {
+		return err
+	}
+	return checkRobotErrCode(res)
+}
+
+// postNotifyJSON
+// 以 JSON 格式 POST 通知内容, 返回响应体
+func postNotifyJSON(webhookUrl string, payload interface{}) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(http.MethodPost, webhookUrl, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	return doNotifyRequest(request)
+}
+
+// doNotifyRequest
+// 发送通知请求, 非 2xx 状态码视为失败
+// 通知地址可经 /test-channel 任意指定, 与抓取页面一样受出站访问策略约束, 错误信息中不包含响应体, 避免借此读取内网服务的响应
+func doNotifyRequest(request *http.Request) ([]byte, error) {
+	client, err := NewFetchClient(model.Job{}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	res, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return res, fmt.Errorf(config.ChannelRespondStatusError, response.StatusCode)
+	}
+	return res, nil
+}
+
+// checkRobotErrCode
+// 钉钉、企业微信及飞书机器人出错时仍返回 200, 需要检查响应体中的错误码
+func checkRobotErrCode(res []byte) error {
+	var result struct {
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		Code    *int   `json:"code"`
+		Msg     string `json:"msg"`
+	}
+	if json.Unmarshal(res, &result) != nil {
+		return nil
+	}
+	if result.ErrCode != nil && *result.ErrCode != 0 {
+		return fmt.Errorf(config.ChannelRespondError, result.ErrMsg)
+	}
+	if result.Code != nil && *result.Code != 0 {
+		return fmt.Errorf(config.ChannelRespondError, result.Msg)
+	}
+	return nil
+}
+
+// signHmacSHA256
+// 计算 HMAC-SHA256 签名并进行 base64 编码
+func signHmacSHA256(key, content string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(content))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// appendUrlQuery
+// 向 URL 追加查询参数
+func appendUrlQuery(rawUrl string, query url.Values) string {
+	if strings.Contains(rawUrl, "?") {
+		return rawUrl + "&" + query.Encode()
+	}
+	return rawUrl + "?" + query.Encode()
+}
@@ -0,0 +1,334 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// notifyRequest
+// 模拟的通知接口收到的请求
+type notifyRequest struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   map[string]interface{}
+}
+
+// newNotifyServer
+// 启动模拟的通知接口, 以指定状态码及响应体应答, 返回接口地址及收到的请求
+// 模拟的接口位于本机, 测试期间允许访问内网地址
+func newNotifyServer(t *testing.T, status int, response string) (string, *notifyRequest) {
+	allowPrivateNetworks(t)
+	received := &notifyRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.method = r.Method
+		received.path = r.URL.Path
+		received.query = r.URL.Query()
+		received.header = r.Header.Clone()
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &received.body); err != nil {
+			t.Errorf("request body %q is not JSON: %v", body, err)
+		}
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, response)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, received
+}
+
+// allowPrivateNetworks
+// 测试期间关闭对内网地址的限制, 测试结束后恢复
+func allowPrivateNetworks(t *testing.T) {
+	oldDenyPrivate := config.DenyPrivateNetworks
+	config.DenyPrivateNetworks = false
+	t.Cleanup(func() { config.DenyPrivateNetworks = oldDenyPrivate })
+}
+
+func testNotifyMessage() NotifyMessage {
+	return NotifyMessage{
+		Subject:  "Price changed",
+		Content:  "<p>old: 1</p><p>new: 2</p>",
+		JobName:  "price",
+		JobUrl:   "http://example.com/",
+		OldValue: "1",
+		NewValue: "2",
+	}
+}
+
+// wantSign
+// 按 HMAC-SHA256 及 base64 计算预期的签名
+func wantSign(key, content string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(content))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	serverUrl, received := newNotifyServer(t, http.StatusOK, "ok")
+	message := testNotifyMessage()
+	err := WebhookNotifier{Channel: model.Channel{
+		Url:     serverUrl + "/hook",
+		Method:  "put",
+		Headers: `{"X-Token": "secret"}`,
+		Body:    `{"name": {{json .JobName}}, "text": {{json .Text}}, "new": {{json .NewValue}}}`,
+	}}.Notify(message)
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if received.method != http.MethodPut || received.path != "/hook" {
+		t.Errorf("request = %s %s, want PUT /hook", received.method, received.path)
+	}
+	if received.header.Get("X-Token") != "secret" || received.header.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v", received.header)
+	}
+	if received.body["name"] != "price" || received.body["text"] != message.Text() || received.body["new"] != "2" {
+		t.Errorf("body = %v", received.body)
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	serverUrl, received := newNotifyServer(t, http.StatusOK, "ok")
+	message := testNotifyMessage()
+	if err := (SlackNotifier{Url: serverUrl}).Notify(message); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if received.method != http.MethodPost || received.body["text"] != message.Text() {
+		t.Errorf("request = %s %v", received.method, received.body)
+	}
+}
+
+func TestTelegramNotifier(t *testing.T) {
+	serverUrl, received := newNotifyServer(t, http.StatusOK, `{"ok": true}`)
+	message := testNotifyMessage()
+	if err := (TelegramNotifier{Url: serverUrl + "/", Token: "123:abc", ChatID: "42"}).Notify(message); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if received.path != "/bot123:abc/sendMessage" {
+		t.Errorf("path = %s, want /bot123:abc/sendMessage", received.path)
+	}
+	if received.body["chat_id"] != "42" || received.body["text"] != message.Text() {
+		t.Errorf("body = %v", received.body)
+	}
+
+	serverUrl, _ = newNotifyServer(t, http.StatusOK, `{"ok": false, "description": "chat not found"}`)
+	err := TelegramNotifier{Url: serverUrl, Token: "123:abc", ChatID: "42"}.Notify(message)
+	if err == nil || !strings.Contains(err.Error(), "chat not found") {
+		t.Errorf("Notify() error = %v, want the description of the failure", err)
+	}
+}
+
+func TestDingTalkNotifier(t *testing.T) {
+	serverUrl, received := newNotifyServer(t, http.StatusOK, `{"errcode": 0, "errmsg": "ok"}`)
+	message := testNotifyMessage()
+	if err := (DingTalkNotifier{Url: serverUrl + "/robot/send?access_token=t", Secret: "SEC1"}).Notify(message); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	timestamp := received.query.Get("timestamp")
+	if received.query.Get("access_token") != "t" || timestamp == "" {
+		t.Fatalf("query = %v", received.query)
+	}
+	if sign := received.query.Get("sign"); sign != wantSign("SEC1", timestamp+"\nSEC1") {
+		t.Errorf("sign = %s, want %s", sign, wantSign("SEC1", timestamp+"\nSEC1"))
+	}
+	text, _ := received.body["text"].(map[string]interface{})
+	if received.body["msgtype"] != "text" || text["content"] != message.Text() {
+		t.Errorf("body = %v", received.body)
+	}
+
+	// 未配置 Secret 时不加签
+	serverUrl, received = newNotifyServer(t, http.StatusOK, `{"errcode": 0}`)
+	if err := (DingTalkNotifier{Url: serverUrl}).Notify(message); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if received.query.Has("sign") || received.query.Has("timestamp") {
+		t.Errorf("query = %v, want no signature", received.query)
+	}
+}
+
+func TestWeComNotifier(t *testing.T) {
+	serverUrl, received := newNotifyServer(t, http.StatusOK, `{"errcode": 0, "errmsg": "ok"}`)
+	message := testNotifyMessage()
+	if err := (WeComNotifier{Url: serverUrl}).Notify(message); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	text, _ := received.body["text"].(map[string]interface{})
+	if received.body["msgtype"] != "text" || text["content"] != message.Text() {
+		t.Errorf("body = %v", received.body)
+	}
+
+	serverUrl, _ = newNotifyServer(t, http.StatusOK, `{"errcode": 93000, "errmsg": "invalid webhook url"}`)
+	err := WeComNotifier{Url: serverUrl}.Notify(message)
+	if err == nil || !strings.Contains(err.Error(), "invalid webhook url") {
+		t.Errorf("Notify() error = %v, want the errmsg", err)
+	}
+}
+
+func TestFeishuNotifier(t *testing.T) {
+	serverUrl, received := newNotifyServer(t, http.StatusOK, `{"code": 0, "msg": "success"}`)
+	message := testNotifyMessage()
+	if err := (FeishuNotifier{Url: serverUrl, Secret: "SEC2"}).Notify(message); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	timestamp, _ := received.body["timestamp"].(string)
+	if timestamp == "" {
+		t.Fatalf("body = %v, want a timestamp", received.body)
+	}
+	if sign := received.body["sign"]; sign != wantSign(timestamp+"\nSEC2", "") {
+		t.Errorf("sign = %v, want %s", sign, wantSign(timestamp+"\nSEC2", ""))
+	}
+	content, _ := received.body["content"].(map[string]interface{})
+	if received.body["msg_type"] != "text" || content["text"] != message.Text() {
+		t.Errorf("body = %v", received.body)
+	}
+
+	serverUrl, _ = newNotifyServer(t, http.StatusOK, `{"code": 19021, "msg": "sign match fail"}`)
+	err := FeishuNotifier{Url: serverUrl, Secret: "SEC2"}.Notify(message)
+	if err == nil || !strings.Contains(err.Error(), "sign match fail") {
+		t.Errorf("Notify() error = %v, want the msg", err)
+	}
+}
+
+func TestCheckRobotErrCode(t *testing.T) {
+	tests := []struct {
+		response string
+		wantErr  string
+	}{
+		{`{"errcode": 0, "errmsg": "ok"}`, ""},
+		{`{"errcode": 310000, "errmsg": "sign not match"}`, "sign not match"},
+		{`{"code": 0, "msg": "success"}`, ""},
+		{`{"code": 9499, "msg": "Bad Request"}`, "Bad Request"},
+		{`{"StatusCode": 0}`, ""},
+		{`not json`, ""},
+	}
+	for _, test := range tests {
+		err := checkRobotErrCode([]byte(test.response))
+		if test.wantErr == "" && err != nil {
+			t.Errorf("checkRobotErrCode(%s) error = %v, want nil", test.response, err)
+		}
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("checkRobotErrCode(%s) error = %v, want %q", test.response, err, test.wantErr)
+		}
+	}
+}
+
+func TestDoNotifyRequestStatus(t *testing.T) {
+	for _, status := range []int{http.StatusMovedPermanently, http.StatusBadRequest, http.StatusInternalServerError} {
+		serverUrl, _ := newNotifyServer(t, status, `{"secret": "internal"}`)
+		err := SlackNotifier{Url: serverUrl}.Notify(testNotifyMessage())
+		if err == nil || !strings.Contains(err.Error(), strconv.Itoa(status)) {
+			t.Errorf("status %d: Notify() error = %v, want the status", status, err)
+		}
+		if err != nil && strings.Contains(err.Error(), "internal") {
+			t.Errorf("status %d: Notify() error = %v, want the response body left out", status, err)
+		}
+	}
+	serverUrl, _ := newNotifyServer(t, http.StatusNoContent, "")
+	if err := (SlackNotifier{Url: serverUrl}).Notify(testNotifyMessage()); err != nil {
+		t.Errorf("status 204: Notify() error = %v, want nil", err)
+	}
+}
+
+func TestDoNotifyRequestOutboundPolicy(t *testing.T) {
+	serverUrl, received := newNotifyServer(t, http.StatusOK, "ok")
+	config.DenyPrivateNetworks = true
+	err := SlackNotifier{Url: serverUrl}.Notify(testNotifyMessage())
+	if err == nil {
+		t.Fatal("Notify() error = nil, want the loopback address refused")
+	}
+	if received.method != "" {
+		t.Errorf("request reached the server: %s %s", received.method, received.path)
+	}
+	for _, metadataUrl := range []string{"http://169.254.169.254/latest/meta-data/", "http://10.0.0.1/admin"} {
+		if err := (WebhookNotifier{Channel: model.Channel{Url: metadataUrl}}).Notify(testNotifyMessage()); err == nil {
+			t.Errorf("Notify(%s) error = nil, want it refused", metadataUrl)
+		}
+	}
+}
+
+func TestSealAndOpenChannel(t *testing.T) {
+	oldKey := config.SecretKey
+	config.SecretKey = "test-key"
+	t.Cleanup(func() { config.SecretKey = oldKey })
+
+	channel := model.Channel{
+		Type:    model.ChannelDingTalk,
+		Url:     "https://oapi.dingtalk.com/robot/send?access_token=abc",
+		Token:   "token",
+		Secret:  "secret",
+		Headers: `{"Authorization": "Bearer xxx"}`,
+		ChatID:  "chat",
+	}
+	sealed, err := SealChannel(channel)
+	if err != nil {
+		t.Fatalf("SealChannel() error = %v", err)
+	}
+	for name, value := range map[string]string{"url": sealed.Url, "token": sealed.Token, "secret": sealed.Secret, "headers": sealed.Headers} {
+		if !strings.HasPrefix(value, encryptedPrefix) {
+			t.Errorf("sealed %s = %q, want it encrypted", name, value)
+		}
+	}
+	if sealed.ChatID != channel.ChatID {
+		t.Errorf("sealed chat id = %q, want it unchanged", sealed.ChatID)
+	}
+	opened, err := OpenChannel(sealed)
+	if err != nil {
+		t.Fatalf("OpenChannel() error = %v", err)
+	}
+	if opened != channel {
+		t.Errorf("OpenChannel() = %+v, want %+v", opened, channel)
+	}
+
+	// 通用 webhook 的地址不是凭据, 不加密
+	webhook, err := SealChannel(model.Channel{Type: model.ChannelWebhook, Url: "https://example.com/hook"})
+	if err != nil || webhook.Url != "https://example.com/hook" {
+		t.Errorf("SealChannel() webhook url = %q, %v, want it unchanged", webhook.Url, err)
+	}
+	// 加密存储之前保存的明文原样使用
+	legacy := model.Channel{Type: model.ChannelTelegram, Token: "plain"}
+	if opened, err = OpenChannel(legacy); err != nil || opened.Token != "plain" {
+		t.Errorf("OpenChannel() legacy token = %q, %v, want plain", opened.Token, err)
+	}
+
+	config.SecretKey = ""
+	if _, err = SealChannel(channel); err == nil {
+		t.Error("SealChannel() without a secret key error = nil, want an error")
+	}
+}
+
+func TestMaskAndRestoreChannel(t *testing.T) {
+	stored := model.Channel{
+		Type:    model.ChannelFeishu,
+		Url:     "https://open.feishu.cn/open-apis/bot/v2/hook/abc",
+		Secret:  "secret",
+		Headers: `{"X-Key": "1"}`,
+	}
+	masked := MaskChannel(stored)
+	if masked.Url != config.PasswordEncoded || masked.Secret != config.PasswordEncoded || masked.Headers != config.PasswordEncoded {
+		t.Errorf("MaskChannel() = %+v, want the credentials masked", masked)
+	}
+	if masked.Token != "" {
+		t.Errorf("MaskChannel() token = %q, want an empty value to stay empty", masked.Token)
+	}
+
+	// 未修改的掩码沿用原值, 新填写的值及清空的值以请求为准
+	update := masked
+	update.Secret = "new-secret"
+	update.Headers = ""
+	restored := RestoreMaskedChannel(update, stored)
+	if restored.Url != stored.Url || restored.Secret != "new-secret" || restored.Headers != "" {
+		t.Errorf("RestoreMaskedChannel() = %+v", restored)
+	}
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"surveillance-guy/config"
+)
+
+// hostLimiters 每个主机一个限流器, 所有任务、重试及登录步骤共用
+var hostLimiters sync.Map
+
+// hostLimiter
+// 单个主机的请求频率限制及最短间隔
+type hostLimiter struct {
+	mutex   sync.Mutex
+	limiter *rate.Limiter
+	next    time.Time // 按最短间隔计算的下次允许请求的时间
+}
+
+// ThrottleError
+// 对主机的请求需等待的时间超过上限, 放弃本次抓取, 执行记录记为 deferred 而非失败
+type ThrottleError struct {
+	Host string
+	Wait time.Duration
+}
+
+func (e *ThrottleError) Error() string {
+	return fmt.Sprintf(config.HostThrottled, e.Host, e.Wait.Round(time.Millisecond))
+}
+
+// WaitHost
+// 按主机的请求频率及最短间隔等待轮到本次请求, 需等待的时间超过上限时不占用名额并返回 ThrottleError
+// 最短间隔取配置值与 robots.txt 中 Crawl-delay 的较大者
+func WaitHost(ctx context.Context, host string) error {
+	host = strings.ToLower(host)
+	minDelay := time.Duration(config.MinHostDelay) * time.Millisecond
+	if crawlDelay := robotsCrawlDelay(host); crawlDelay > minDelay {
+		minDelay = crawlDelay
+	}
+	if config.HostRate <= 0 && minDelay <= 0 {
+		return nil
+	}
+	value, _ := hostLimiters.LoadOrStore(host, &hostLimiter{})
+	limiter := value.(*hostLimiter)
+	limiter.mutex.Lock()
+	now := time.Now()
+	start := now
+	var reservation *rate.Reservation
+	if config.HostRate > 0 {
+		if limiter.limiter == nil {
+			limiter.limiter = rate.NewLimiter(rate.Limit(config.HostRate), config.HostBurst)
+		}
+		reservation = limiter.limiter.ReserveN(now, 1)
+		start = now.Add(reservation.DelayFrom(now))
+	}
+	if limiter.next.After(start) {
+		start = limiter.next
+	}
+	wait := start.Sub(now)
+	if wait > time.Duration(config.MaxThrottleWait)*time.Second {
+		if reservation != nil {
+			reservation.CancelAt(now)
+		}
+		limiter.mutex.Unlock()
+		return &ThrottleError{Host: host, Wait: wait}
+	}
+	limiter.next = start.Add(minDelay)
+	limiter.mutex.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
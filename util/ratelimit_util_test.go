@@ -0,0 +1,117 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// setPoliteness
+// 设置限流配置并清空主机限流器, 测试结束后恢复
+func setPoliteness(t *testing.T, hostRate float64, hostBurst, minHostDelay, maxThrottleWait int) {
+	oldRate, oldBurst, oldDelay, oldWait := config.HostRate, config.HostBurst, config.MinHostDelay, config.MaxThrottleWait
+	config.HostRate, config.HostBurst, config.MinHostDelay, config.MaxThrottleWait = hostRate, hostBurst, minHostDelay, maxThrottleWait
+	clearHostLimiters := func() {
+		hostLimiters.Range(func(key, _ interface{}) bool {
+			hostLimiters.Delete(key)
+			return true
+		})
+	}
+	clearHostLimiters()
+	t.Cleanup(func() {
+		config.HostRate, config.HostBurst, config.MinHostDelay, config.MaxThrottleWait = oldRate, oldBurst, oldDelay, oldWait
+		clearHostLimiters()
+	})
+}
+
+func TestWaitHostMinDelay(t *testing.T) {
+	setPoliteness(t, 0, 1, 100, 1)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := WaitHost(context.Background(), "Example.com"); err != nil {
+			t.Fatalf("WaitHost() error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("3 requests took %v, want at least 2 intervals of 100ms", elapsed)
+	}
+	// 主机名不区分大小写, 其他主机不受影响
+	start = time.Now()
+	if err := WaitHost(context.Background(), "other.example.com"); err != nil || time.Since(start) > 50*time.Millisecond {
+		t.Errorf("WaitHost() on another host = %v after %v, want no wait", err, time.Since(start))
+	}
+}
+
+func TestWaitHostDefersLongWaits(t *testing.T) {
+	setPoliteness(t, 0, 1, 10000, 0)
+	if err := WaitHost(context.Background(), "example.com"); err != nil {
+		t.Fatalf("the first WaitHost() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		err := WaitHost(context.Background(), "example.com")
+		var throttleErr *ThrottleError
+		if !errors.As(err, &throttleErr) {
+			t.Fatalf("WaitHost() error = %v, want a ThrottleError", err)
+		}
+		// 推迟的请求不占用名额, 等待时间不会累加
+		if throttleErr.Host != "example.com" || throttleErr.Wait > 10*time.Second || throttleErr.Wait < 9*time.Second {
+			t.Errorf("ThrottleError = %+v, want a wait of about 10s", throttleErr)
+		}
+	}
+}
+
+func TestWaitHostRate(t *testing.T) {
+	setPoliteness(t, 1, 2, 0, 0)
+	// 突发数以内的请求无需等待
+	for i := 0; i < 2; i++ {
+		if err := WaitHost(context.Background(), "example.com"); err != nil {
+			t.Fatalf("WaitHost() within the burst error = %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		var throttleErr *ThrottleError
+		if err := WaitHost(context.Background(), "example.com"); !errors.As(err, &throttleErr) || throttleErr.Wait > time.Second {
+			t.Errorf("WaitHost() over the rate error = %v, want a ThrottleError of at most 1s", err)
+		}
+	}
+}
+
+func TestWaitHostCanceled(t *testing.T) {
+	setPoliteness(t, 0, 1, 10000, 60)
+	if err := WaitHost(context.Background(), "example.com"); err != nil {
+		t.Fatalf("the first WaitHost() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := WaitHost(ctx, "example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitHost() error = %v, want the context error", err)
+	}
+}
+
+func TestWatchJobDeferredWhenThrottled(t *testing.T) {
+	setTestDataBase(t)
+	setPoliteness(t, 0, 1, 10000, 0)
+	page, pageUrl := newValueServer(t)
+	page.set("100")
+	job := model.Job{Name: "price", Url: pageUrl, Pattern: `<b>(.*?)</b>`}
+	config.DataBase.Create(&job)
+
+	runTestJob(t, job.ID)
+	record := runTestJob(t, job.ID)
+	if record.Status != model.RunStatusDeferred || record.Error == "" {
+		t.Errorf("status = %q, error = %q, want a deferred run with the reason", record.Status, record.Error)
+	}
+	// 推迟的执行不计入连续失败次数
+	if err := TrackJobFailure(job.ID, record); err != nil {
+		t.Fatalf("TrackJobFailure() error = %v", err)
+	}
+	var stored model.Job
+	config.DataBase.First(&stored, job.ID)
+	if stored.FailureStreak != 0 {
+		t.Errorf("failure streak = %d after a deferred run, want 0", stored.FailureStreak)
+	}
+}
@@ -1,19 +1,74 @@
 package util
 
 import (
-	"fmt"
 	"regexp"
+	"strings"
 )
 
+// RegexExtractor
+// 正则表达式提取器, 取第一个匹配的第一个捕获组
+// 提取所有匹配时, 每个匹配对应一个结果: 含命名捕获组时结果为所有命名组的 `name=value` 以 ", " 拼接, 否则为第一个捕获组, 没有捕获组时为整个匹配
+type RegexExtractor struct{}
+
+func (RegexExtractor) Extract(content []byte, pattern string) (string, error) {
+	return MatchTargetByRegexPattern(content, pattern)
+}
+
+func (RegexExtractor) ExtractAll(content []byte, pattern string) ([]string, error) {
+	return MatchAllTargetsByRegexPattern(content, pattern)
+}
+
 // MatchTargetByRegexPattern
 // 根据正则表达式匹配目标内容
 func MatchTargetByRegexPattern(content []byte, pattern string) (string, error) {
-	compileRes, _ := regexp.Compile(pattern)
+	compileRes, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
 	items := compileRes.FindSubmatch(content)
 	if len(items) >= 2 {
 		res := string(items[1])
 		return res, nil
 	} else {
-		return "", fmt.Errorf("Can't match target")
+		return "", ErrTargetNotMatch
+	}
+}
+
+// MatchAllTargetsByRegexPattern
+// 根据正则表达式匹配所有目标内容
+func MatchAllTargetsByRegexPattern(content []byte, pattern string) ([]string, error) {
+	compileRes, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	names := compileRes.SubexpNames()
+	hasNamedGroup := false
+	for _, name := range names {
+		if name != "" {
+			hasNamedGroup = true
+		}
+	}
+	// 没有捕获组时取整个匹配
+	groupIndex := 1
+	if compileRes.NumSubexp() == 0 {
+		groupIndex = 0
+	}
+	var targets []string
+	for _, items := range compileRes.FindAllSubmatch(content, -1) {
+		if !hasNamedGroup {
+			targets = append(targets, string(items[groupIndex]))
+			continue
+		}
+		var groups []string
+		for i, name := range names {
+			if name != "" {
+				groups = append(groups, name+"="+string(items[i]))
+			}
+		}
+		targets = append(targets, strings.Join(groups, ", "))
+	}
+	if len(targets) == 0 {
+		return nil, ErrTargetNotMatch
 	}
+	return targets, nil
 }
@@ -0,0 +1,172 @@
+package util
+
+import (
+	"bytes"
+	htmlTemplate "html/template"
+	"strings"
+	textTemplate "text/template"
+	"time"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// NotifyData
+// 通知标题及内容模板可使用的变量, 标题使用 text/template 渲染, 内容使用 html/template 渲染 (变量值会被转义)
+//
+//	{{.Name}}      任务名称
+//	{{.URL}}       监控的页面 URL
+//	{{.OldValue}}  变动前的值
+//	{{.NewValue}}  变动后的值
+//	{{.Diff}}      新旧值之间按行比较的 unified 格式差异
+//	{{.RunTime}}   本次执行的开始时间, 可使用 {{.RunTime.Format "2006-01-02 15:04:05"}} 格式化
+//	{{.Added}}     多值匹配时新增的结果列表
+//	{{.Removed}}   多值匹配时移除的结果列表
+//	{{.OldHash}}   hash 监控方式下变动前的 SHA-256 摘要
+//	{{.NewHash}}   hash 监控方式下变动后的 SHA-256 摘要
+//	{{.OldSize}}   hash 监控方式下变动前的字节数
+//	{{.NewSize}}   hash 监控方式下变动后的字节数
+//	{{.Job}}       任务本身, 可访问任务的任意字段, 如 {{.Job.Pattern}}
+//
+// 可用函数:
+//
+//	{{br .NewValue}}          将换行替换为 <br>
+//	{{lines .Added}}          将列表中的每一项以 <br> 分隔
+//	{{join .Added ", "}}      将列表以指定分隔符拼接
+//
+// 兼容旧的占位符 %name%、%target%、%added%、%removed%, 渲染前分别替换为 {{.Name}}、{{br .NewValue}}、{{lines .Added}}、{{lines .Removed}}
+type NotifyData struct {
+	Name     string
+	URL      string
+	OldValue string
+	NewValue string
+	Diff     string
+	RunTime  time.Time
+	Added    []string
+	Removed  []string
+	OldHash  string
+	NewHash  string
+	OldSize  int64
+	NewSize  int64
+	Job      model.Job
+}
+
+// NewNotifyData
+// 根据任务及新旧值构建通知模板变量
+func NewNotifyData(job model.Job, oldValue, newValue string, added, removed []string, runTime time.Time) NotifyData {
+	return NotifyData{
+		Name:     job.Name,
+		URL:      job.Url,
+		OldValue: oldValue,
+		NewValue: newValue,
+		Diff:     UnifiedDiff(oldValue, newValue, 3),
+		RunTime:  runTime,
+		Added:    added,
+		Removed:  removed,
+		Job:      job,
+	}
+}
+
+// SampleNotifyData
+// 构建用于预览及校验模板的示例变量
+func SampleNotifyData(job model.Job) NotifyData {
+	return NewNotifyData(job, config.SampleOldValue, config.SampleNewValue,
+		[]string{config.SampleNewValue}, []string{config.SampleOldValue}, time.Now())
+}
+
+// legacyPlaceholders 旧占位符与模板语法的对应关系
+var legacyPlaceholders = strings.NewReplacer(
+	"%name%", "{{.Name}}",
+	"%target%", "{{br .NewValue}}",
+	"%added%", "{{lines .Added}}",
+	"%removed%", "{{lines .Removed}}",
+)
+
+var textFuncs = textTemplate.FuncMap{
+	"br":    func(value string) string { return value },
+	"lines": func(values []string) string { return strings.Join(values, "\n") },
+	"join":  strings.Join,
+}
+
+var htmlFuncs = htmlTemplate.FuncMap{
+	"br": func(value string) htmlTemplate.HTML {
+		return htmlTemplate.HTML(strings.ReplaceAll(htmlTemplate.HTMLEscapeString(value), "\n", "<br>"))
+	},
+	"lines": func(values []string) htmlTemplate.HTML {
+		escaped := make([]string, 0, len(values))
+		for _, value := range values {
+			escaped = append(escaped, htmlTemplate.HTMLEscapeString(value))
+		}
+		return htmlTemplate.HTML(strings.Join(escaped, "<br>"))
+	},
+	"join": strings.Join,
+}
+
+// RenderSubject
+// 使用 text/template 渲染通知标题, 模板为空时使用默认标题
+func RenderSubject(subject string, data NotifyData) (string, error) {
+	if subject == "" {
+		subject = config.EmailSubject
+	}
+	tmpl, err := textTemplate.New("subject").Funcs(textFuncs).Parse(legacyPlaceholders.Replace(subject))
+	if err != nil {
+		return "", err
+	}
+	var res bytes.Buffer
+	err = tmpl.Execute(&res, data)
+	if err != nil {
+		return "", err
+	}
+	return res.String(), nil
+}
+
+// RenderContent
+// 使用 html/template 渲染通知内容
+func RenderContent(content string, data NotifyData) (string, error) {
+	tmpl, err := htmlTemplate.New("content").Funcs(htmlFuncs).Parse(legacyPlaceholders.Replace(content))
+	if err != nil {
+		return "", err
+	}
+	var res bytes.Buffer
+	err = tmpl.Execute(&res, data)
+	if err != nil {
+		return "", err
+	}
+	return res.String(), nil
+}
+
+// BuildNotifyMessage
+// 渲染任务的通知标题及内容, 构建通知消息
+func BuildNotifyMessage(job model.Job, data NotifyData) (NotifyMessage, error) {
+	subject, err := RenderSubject(job.Subject, data)
+	if err != nil {
+		return NotifyMessage{}, err
+	}
+	// text 方式下未设置通知内容时发送文本差异, hash 方式下发送新旧摘要及大小
+	contentTemplate := job.Content
+	if contentTemplate == "" && job.MonitorMode == model.MonitorText {
+		contentTemplate = config.TextDiffContent
+	}
+	if contentTemplate == "" && job.MonitorMode == model.MonitorHash {
+		contentTemplate = config.HashChangeContent
+	}
+	content, err := RenderContent(contentTemplate, data)
+	if err != nil {
+		return NotifyMessage{}, err
+	}
+	return NotifyMessage{
+		Subject:  subject,
+		Content:  content,
+		JobName:  job.Name,
+		JobUrl:   job.Url,
+		OldValue: data.OldValue,
+		NewValue: data.NewValue,
+	}, nil
+}
+
+// ValidateNotifyTemplates
+// 使用示例变量渲染通知标题及内容模板, 校验模板是否有效
+func ValidateNotifyTemplates(job model.Job) error {
+	_, err := BuildNotifyMessage(job, SampleNotifyData(job))
+	return err
+}
@@ -0,0 +1,302 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// FetchHTTPPage
+// 按任务的请求配置直接请求页面, 返回状态码、响应头及转码后的页面源码
+// extraCookies 为登录会话附加的 Cookie, 与任务自身的 Cookie 同名时优先
+func FetchHTTPPage(job model.Job, extraCookies []*http.Cookie) (FetchResult, error) {
+	request, err := BuildJobRequest(job)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	cookies, err := ParseJobCookies(job.Cookies)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	// 每次抓取使用独立的 Cookie Jar, 重定向过程中服务端设置的 Cookie 会随后续请求发送
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	jar.SetCookies(request.URL, append(cookies, extraCookies...))
+	conditional := false
+	if !job.NoConditionalGet {
+		conditional = setConditionalHeaders(request, job)
+	}
+	client, err := NewFetchClient(job, jar, redirectPolicy(job))
+	if err != nil {
+		return FetchResult{}, err
+	}
+	// 遵守目标站点的 robots.txt 并按主机限流, 限流等待不计入请求超时
+	err = CheckRobots(job, request.URL)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	err = WaitHost(context.Background(), request.URL.Hostname())
+	if err != nil {
+		return FetchResult{}, err
+	}
+	// 发起请求
+	response, err := client.Do(request)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	// 关闭响应体
+	defer response.Body.Close()
+	page := FetchResult{
+		StatusCode: response.StatusCode,
+		Header:     response.Header,
+	}
+	// 条件请求命中时服务端不返回内容, 视为未变动
+	if conditional && response.StatusCode == http.StatusNotModified {
+		page.Unchanged = true
+		return page, nil
+	}
+	// hash 方式不转码也不保留内容, 边下载边计算摘要, 适用于 PDF、安装包等二进制文件
+	if job.MonitorMode == model.MonitorHash {
+		if job.TrustValidators && validatorsUnchanged(job, response) {
+			page.Unchanged = true
+			return page, nil
+		}
+		page.Hash, page.Size, err = HashResponseBody(response, JobMaxDownloadSize(job))
+		return page, err
+	}
+	page.Body, err = DataEncoding(response.Body)
+	if err != nil {
+		return page, err
+	}
+	return page, nil
+}
+
+// BuildJobRequest
+// 根据任务的请求方法、查询参数、请求头及请求体构建请求
+func BuildJobRequest(job model.Job) (*http.Request, error) {
+	method, err := jobRequestMethod(job.Method)
+	if err != nil {
+		return nil, err
+	}
+	requestUrl, err := BuildJobUrl(job)
+	if err != nil {
+		return nil, err
+	}
+	var body io.Reader
+	if job.Body != "" {
+		body = strings.NewReader(job.Body)
+	}
+	request, err := http.NewRequest(method, requestUrl, body)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := ParseJobHeaders(job.Headers)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", config.UserAgent)
+	if job.Body != "" {
+		request.Header.Set("Content-Type", guessContentType(job.Body))
+	}
+	// 任务自定义的请求头优先
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	return request, nil
+}
+
+// setConditionalHeaders
+// 以上次响应的 ETag 及 Last-Modified 设置条件请求头, 任务自定义了同名请求头时不覆盖, 返回是否为条件请求
+func setConditionalHeaders(request *http.Request, job model.Job) bool {
+	if job.ETag != "" && request.Header.Get("If-None-Match") == "" {
+		request.Header.Set("If-None-Match", job.ETag)
+	}
+	if job.LastModified != "" && request.Header.Get("If-Modified-Since") == "" {
+		request.Header.Set("If-Modified-Since", job.LastModified)
+	}
+	return request.Header.Get("If-None-Match") != "" || request.Header.Get("If-Modified-Since") != ""
+}
+
+// BuildJobUrl
+// 将任务的查询参数追加到 URL 上, 与 URL 中已有的同名参数并存
+func BuildJobUrl(job model.Job) (string, error) {
+	query, err := ParseJobQuery(job.Query)
+	if err != nil {
+		return "", err
+	}
+	if len(query) == 0 {
+		return job.Url, nil
+	}
+	parsed, err := url.Parse(job.Url)
+	if err != nil {
+		return "", err
+	}
+	values := parsed.Query()
+	for key, value := range query {
+		values.Add(key, value)
+	}
+	parsed.RawQuery = values.Encode()
+	return parsed.String(), nil
+}
+
+// ParseJobHeaders
+// 解析 JSON 对象形式的请求头, 为空时返回空集合
+func ParseJobHeaders(headers string) (map[string]string, error) {
+	return parseJSONObject(headers, config.JobHeadersInvalid)
+}
+
+// ParseJobQuery
+// 解析 JSON 对象形式的查询参数, 为空时返回空集合
+func ParseJobQuery(query string) (map[string]string, error) {
+	return parseJSONObject(query, config.JobQueryInvalid)
+}
+
+// parseJSONObject
+// 解析值均为字符串的 JSON 对象
+func parseJSONObject(content string, message string) (map[string]string, error) {
+	values := make(map[string]string)
+	if strings.TrimSpace(content) == "" {
+		return values, nil
+	}
+	err := json.Unmarshal([]byte(content), &values)
+	if err != nil {
+		return nil, fmt.Errorf(message, err)
+	}
+	return values, nil
+}
+
+// ParseJobCookies
+// 解析 Cookie 请求头格式的字符串, 如 "a=1; b=2"
+func ParseJobCookies(cookies string) ([]*http.Cookie, error) {
+	if strings.TrimSpace(cookies) == "" {
+		return nil, nil
+	}
+	// 借助 http.Request 解析 Cookie 请求头, 无法解析的条目会被忽略
+	request := http.Request{Header: http.Header{"Cookie": {cookies}}}
+	parsed := request.Cookies()
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf(config.JobCookiesInvalid, cookies)
+	}
+	return parsed, nil
+}
+
+// ValidateJobRequest
+// 校验任务的请求配置, browser 抓取方式仅支持不带请求体的 GET 请求
+func ValidateJobRequest(job model.Job) error {
+	method, err := jobRequestMethod(job.Method)
+	if err != nil {
+		return err
+	}
+	if _, err = BuildJobUrl(job); err != nil {
+		return err
+	}
+	if _, err = ParseJobHeaders(job.Headers); err != nil {
+		return err
+	}
+	if _, err = ParseJobCookies(job.Cookies); err != nil {
+		return err
+	}
+	if job.MaxRedirects < 0 {
+		return fmt.Errorf(config.JobMaxRedirectsInvalid, job.MaxRedirects)
+	}
+	if job.FetchMode == model.FetchBrowser && (method != http.MethodGet || job.Body != "") {
+		return errors.New(config.BrowserRequestUnsupported)
+	}
+	if err = ValidateJobProxy(job.Proxy); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SameOrigin
+// 判断两个 URL 的协议、主机及端口是否相同, 任一无法解析时视为不同
+func SameOrigin(rawUrl, otherUrl string) bool {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return false
+	}
+	other, err := url.Parse(otherUrl)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(parsed.Scheme, other.Scheme) && strings.EqualFold(parsed.Host, other.Host)
+}
+
+// WithoutCredentials
+// 去掉任务中可能携带凭据的请求配置, 包括请求头、Cookie、登录会话、查询参数及请求体, 请求方法恢复为 GET
+func WithoutCredentials(job model.Job) model.Job {
+	job.Method = ""
+	job.Headers = ""
+	job.Query = ""
+	job.Body = ""
+	job.Cookies = ""
+	job.SessionID = 0
+	return job
+}
+
+// jobRequestMethod
+// 规范化请求方法, 为空时默认 GET
+func jobRequestMethod(method string) (string, error) {
+	method = strings.ToUpper(strings.TrimSpace(method))
+	switch method {
+	case "":
+		return http.MethodGet, nil
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodHead, http.MethodOptions:
+		return method, nil
+	}
+	return "", fmt.Errorf(config.JobMethodInvalid, method)
+}
+
+// guessContentType
+// 根据请求体内容推断 Content-Type, 以 { 或 [ 开头视为 JSON, 否则视为表单
+func guessContentType(body string) string {
+	trimmed := strings.TrimSpace(body)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		return "application/json"
+	}
+	return "application/x-www-form-urlencoded"
+}
+
+// redirectPolicy
+// 根据任务配置生成重定向策略
+func redirectPolicy(job model.Job) func(request *http.Request, via []*http.Request) error {
+	maxRedirects := job.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = config.DefaultMaxRedirects
+	}
+	return func(request *http.Request, via []*http.Request) error {
+		if job.NoRedirect {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= maxRedirects {
+			return fmt.Errorf(config.TooManyRedirects, maxRedirects)
+		}
+		return nil
+	}
+}
+
+// browserRequestCredentials
+// browser 抓取方式附加的任务自定义请求头, 以及任务的 Cookie 和登录会话的 Cookie
+func browserRequestCredentials(job model.Job, extraCookies []*http.Cookie) (map[string]string, []*http.Cookie, error) {
+	headers, err := ParseJobHeaders(job.Headers)
+	if err != nil {
+		return nil, nil, err
+	}
+	cookies, err := ParseJobCookies(job.Cookies)
+	if err != nil {
+		return nil, nil, err
+	}
+	return headers, append(cookies, extraCookies...), nil
+}
@@ -0,0 +1,153 @@
+package util
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// FetchError
+// 经过分类的页面抓取失败原因
+type FetchError struct {
+	Type       string        // 失败类型, 取值见 model.Failure*
+	StatusCode int           // 目标页面响应状态码, 未收到响应时为 0
+	Retryable  bool          // 是否可以重试
+	RetryAfter time.Duration // 服务端通过 Retry-After 要求的等待时间
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// FetchJobPageWithRetry
+// 抓取页面, 响应状态码不低于 400 时视为失败, 可重试的失败按指数退避加随机抖动重试, 返回抓取结果及尝试次数
+func FetchJobPageWithRetry(job model.Job) (FetchResult, int, error) {
+	for attempt := 1; ; attempt++ {
+		page, err := FetchJobPage(job)
+		if err == nil && page.StatusCode >= http.StatusBadRequest {
+			err = fmt.Errorf(config.FetchStatusError, page.StatusCode)
+		}
+		if err == nil {
+			return page, attempt, nil
+		}
+		fetchErr := ClassifyFetchError(err, page)
+		if !fetchErr.Retryable || attempt > config.Retries {
+			return page, attempt, fetchErr
+		}
+		delay, ok := retryDelay(attempt, fetchErr.RetryAfter)
+		if !ok {
+			return page, attempt, fetchErr
+		}
+		glog.Warningf("[Job#%d][%s]Fetch failed (%s), retrying in %s (%d/%d): %s",
+			job.ID, job.Name, fetchErr.Type, delay, attempt, config.Retries, err.Error())
+		time.Sleep(delay)
+	}
+}
+
+// ClassifyFetchError
+// 根据错误及响应判断失败类型、是否可以重试及 Retry-After
+// 超时、连接失败、DNS 临时错误、5xx 及 429 可以重试, TLS 错误及其余 4xx 重试无意义
+func ClassifyFetchError(err error, page FetchResult) *FetchError {
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr
+	}
+	fetchErr = &FetchError{Type: model.FailureOther, StatusCode: page.StatusCode, Err: err}
+	var (
+		dnsErr     *net.DNSError
+		netErr     net.Error
+		opErr      *net.OpError
+		verifyErr  *tls.CertificateVerificationError
+		headerErr  tls.RecordHeaderError
+		unknownErr x509.UnknownAuthorityError
+		hostErr    x509.HostnameError
+		invalidErr x509.CertificateInvalidError
+	)
+	switch {
+	case page.StatusCode >= http.StatusInternalServerError:
+		fetchErr.Type = model.FailureHTTP5xx
+		fetchErr.Retryable = true
+		fetchErr.RetryAfter = parseRetryAfter(page.Header.Get("Retry-After"), time.Now())
+	case page.StatusCode >= http.StatusBadRequest:
+		fetchErr.Type = model.FailureHTTP4xx
+		fetchErr.Retryable = page.StatusCode == http.StatusTooManyRequests
+		fetchErr.RetryAfter = parseRetryAfter(page.Header.Get("Retry-After"), time.Now())
+	case errors.As(err, &dnsErr):
+		fetchErr.Type = model.FailureDNS
+		fetchErr.Retryable = !dnsErr.IsNotFound
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		fetchErr.Type = model.FailureTimeout
+		fetchErr.Retryable = true
+	case errors.As(err, &verifyErr) || errors.As(err, &headerErr) || errors.As(err, &unknownErr) ||
+		errors.As(err, &hostErr) || errors.As(err, &invalidErr) || strings.Contains(err.Error(), "tls: "):
+		// 握手阶段的 TLS 告警没有导出的错误类型, 只能根据错误信息判断
+		fetchErr.Type = model.FailureTLS
+	case (errors.As(err, &opErr) && opErr.Op == "dial") || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		fetchErr.Type = model.FailureConnect
+		fetchErr.Retryable = true
+	}
+	return fetchErr
+}
+
+// retryDelay
+// 计算第 attempt 次失败后的等待时间, 在指数退避时长的一半到全部之间随机取值
+// 服务端要求的 Retry-After 更长时以其为准, 超过最长等待时间时返回 false 放弃重试
+func retryDelay(attempt int, retryAfter time.Duration) (time.Duration, bool) {
+	maxBackoff := time.Duration(config.RetryMaxBackoff) * time.Second
+	if retryAfter > maxBackoff {
+		return 0, false
+	}
+	backoff := time.Duration(config.RetryBackoff) * time.Second
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay, true
+}
+
+// parseRetryAfter
+// 解析 Retry-After 响应头, 支持秒数及 HTTP 日期两种形式, 无法解析时返回 0
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	at, err := http.ParseTime(value)
+	if err != nil || !at.After(now) {
+		return 0
+	}
+	return at.Sub(now)
+}
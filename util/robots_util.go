@@ -0,0 +1,206 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+var (
+	// robotsCache 按站点 (scheme://host) 缓存解析后的 robots.txt
+	robotsCache sync.Map
+	// robotsCrawlDelays 按主机名缓存 robots.txt 中的 Crawl-delay, 供限流使用
+	robotsCrawlDelays sync.Map
+)
+
+// robotsMaxSize robots.txt 最多读取的字节数, 超出部分忽略
+var robotsMaxSize int64 = 500 << 10
+
+// robotsRules
+// 解析后适用于本程序的 robots.txt 规则
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+	expires    time.Time
+}
+
+// robotsRule
+// 单条 Allow 或 Disallow 规则, 支持 * 通配及 $ 结尾
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+// CheckRobots
+// 全局开启遵守 robots.txt 且任务未设置忽略时, 校验目标地址是否被允许抓取
+func CheckRobots(job model.Job, target *url.URL) error {
+	if !config.RespectRobots || job.IgnoreRobots {
+		return nil
+	}
+	rules, err := loadRobots(job, target)
+	if err != nil {
+		return err
+	}
+	path := target.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if target.RawQuery != "" {
+		path += "?" + target.RawQuery
+	}
+	if !rules.allowed(path) {
+		return &FetchError{Type: model.FailureRobots, Err: fmt.Errorf(config.RobotsDisallowed, target.String())}
+	}
+	return nil
+}
+
+// robotsCrawlDelay
+// 获取已缓存的主机 Crawl-delay, 未开启遵守 robots.txt 或尚未获取时为 0
+func robotsCrawlDelay(host string) time.Duration {
+	if !config.RespectRobots {
+		return 0
+	}
+	if value, ok := robotsCrawlDelays.Load(host); ok {
+		return value.(time.Duration)
+	}
+	return 0
+}
+
+// loadRobots
+// 获取站点的 robots.txt 规则, 缓存过期后以任务的网络配置重新获取
+// 响应 4xx 视为不限制, 其余非 2xx 响应返回错误, 避免站点异常时误抓受限页面
+func loadRobots(job model.Job, target *url.URL) (*robotsRules, error) {
+	site := target.Scheme + "://" + target.Host
+	if value, ok := robotsCache.Load(site); ok && time.Now().Before(value.(*robotsRules).expires) {
+		return value.(*robotsRules), nil
+	}
+	err := WaitHost(context.Background(), target.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewFetchClient(job, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(http.MethodGet, site+"/robots.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", config.UserAgent)
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	rules := &robotsRules{}
+	switch {
+	case response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices:
+		content, err := io.ReadAll(io.LimitReader(response.Body, robotsMaxSize))
+		if err != nil {
+			return nil, err
+		}
+		rules = parseRobots(content, config.RobotsUserAgent)
+	case response.StatusCode >= http.StatusBadRequest && response.StatusCode < http.StatusInternalServerError:
+	default:
+		return nil, fmt.Errorf(config.RobotsFetchFail, site, response.StatusCode)
+	}
+	rules.expires = time.Now().Add(time.Duration(config.RobotsCacheTTL) * time.Second)
+	robotsCache.Store(site, rules)
+	robotsCrawlDelays.Store(strings.ToLower(target.Hostname()), rules.crawlDelay)
+	return rules, nil
+}
+
+// parseRobots
+// 解析 robots.txt, 使用 User-agent 与 agent 相同的分组, 没有时使用 * 分组
+func parseRobots(content []byte, agent string) *robotsRules {
+	agent = strings.ToLower(agent)
+	groups := make(map[string]*robotsRules)
+	var current []*robotsRules
+	// 连续的 User-agent 行共用一组规则, 其后出现的规则行结束分组的声明
+	inRules := false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if index := strings.Index(line, "#"); index >= 0 {
+			line = line[:index]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if key == "user-agent" {
+			if inRules {
+				current = nil
+				inRules = false
+			}
+			name := strings.ToLower(value)
+			if groups[name] == nil {
+				groups[name] = &robotsRules{}
+			}
+			current = append(current, groups[name])
+			continue
+		}
+		inRules = true
+		for _, group := range current {
+			switch key {
+			case "allow", "disallow":
+				// 空的 Disallow 表示不限制
+				if value != "" {
+					group.rules = append(group.rules, newRobotsRule(key == "allow", value))
+				}
+			case "crawl-delay":
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					group.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+	if group, ok := groups[agent]; ok {
+		return group
+	}
+	if group, ok := groups["*"]; ok {
+		return group
+	}
+	return &robotsRules{}
+}
+
+// newRobotsRule
+// 将规则路径转换为正则表达式, * 匹配任意字符, 结尾的 $ 表示必须完全匹配
+func newRobotsRule(allow bool, path string) robotsRule {
+	anchored := strings.HasSuffix(path, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(strings.TrimSuffix(path, "$")), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return robotsRule{allow: allow, length: len(path), pattern: regexp.MustCompile(expr)}
+}
+
+// allowed
+// 判断路径是否允许抓取, 以匹配的最长规则为准, 长度相同时 Allow 优先
+func (rules *robotsRules) allowed(path string) bool {
+	allow, length := true, -1
+	for _, rule := range rules.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > length || (rule.length == length && rule.allow) {
+			allow, length = rule.allow, rule.length
+		}
+	}
+	return allow
+}
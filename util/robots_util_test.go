@@ -0,0 +1,127 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+func TestParseRobots(t *testing.T) {
+	content := []byte(`
+# 其他爬虫
+User-agent: otherbot
+Disallow: /
+
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search?q=
+Allow: /search?q=ok
+Disallow: /tie
+Allow: /tie
+Disallow:
+Crawl-delay: 2.5
+`)
+	rules := parseRobots(content, "surveillance-guy")
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"/private", false},
+		{"/private/secret", false},
+		// 以匹配的最长规则为准
+		{"/private/public", true},
+		{"/private/public/page", true},
+		{"/files/a.pdf", false},
+		{"/files/a.pdf?download=1", true},
+		{"/search?q=test", false},
+		{"/search?q=ok", true},
+		// 长度相同时 Allow 优先
+		{"/tie", true},
+	}
+	for _, test := range tests {
+		if got := rules.allowed(test.path); got != test.want {
+			t.Errorf("allowed(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+	if rules.crawlDelay != 2500*time.Millisecond {
+		t.Errorf("crawl delay = %v, want 2.5s", rules.crawlDelay)
+	}
+
+	// 有同名分组时只使用该分组, 连续的 User-agent 行共用一组规则
+	content = []byte("User-agent: *\nDisallow: /\n\nUser-agent: a\nUser-agent: Surveillance-Guy\nDisallow: /admin\n")
+	rules = parseRobots(content, "surveillance-guy")
+	if !rules.allowed("/page") || rules.allowed("/admin/users") {
+		t.Error("the rules of the matching user agent group were not used")
+	}
+	if rules = parseRobots([]byte("User-agent: otherbot\nDisallow: /\n"), "surveillance-guy"); !rules.allowed("/") {
+		t.Error("a robots.txt without a matching group should allow everything")
+	}
+}
+
+func TestCheckRobots(t *testing.T) {
+	setTestDataBase(t)
+	oldRespect, oldTTL := config.RespectRobots, config.RobotsCacheTTL
+	config.RespectRobots, config.RobotsCacheTTL = true, 3600
+	t.Cleanup(func() { config.RespectRobots, config.RobotsCacheTTL = oldRespect, oldTTL })
+
+	newRobotsServer := func(status int, content string) (*url.URL, *int) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(status)
+			fmt.Fprint(w, content)
+		}))
+		t.Cleanup(server.Close)
+		site, _ := url.Parse(server.URL)
+		t.Cleanup(func() {
+			robotsCache.Delete(site.Scheme + "://" + site.Host)
+			robotsCrawlDelays.Delete(site.Hostname())
+			hostLimiters.Delete(site.Hostname())
+		})
+		return site, &requests
+	}
+	target := func(site *url.URL, path string) *url.URL {
+		parsed, _ := url.Parse(site.String() + path)
+		return parsed
+	}
+
+	site, requests := newRobotsServer(http.StatusOK, "User-agent: *\nDisallow: /private\nCrawl-delay: 1\n")
+	if err := CheckRobots(model.Job{}, target(site, "/page")); err != nil {
+		t.Errorf("CheckRobots(/page) error = %v, want allowed", err)
+	}
+	err := CheckRobots(model.Job{}, target(site, "/private/page"))
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) || fetchErr.Type != model.FailureRobots {
+		t.Errorf("CheckRobots(/private/page) error = %v, want a robots failure", err)
+	}
+	if err = CheckRobots(model.Job{IgnoreRobots: true}, target(site, "/private/page")); err != nil {
+		t.Errorf("CheckRobots() with ignoreRobots error = %v, want allowed", err)
+	}
+	// robots.txt 在缓存有效期内只获取一次, Crawl-delay 供限流使用
+	if *requests != 1 {
+		t.Errorf("robots.txt requested %d times, want 1", *requests)
+	}
+	if delay := robotsCrawlDelay(site.Hostname()); delay != time.Second {
+		t.Errorf("robotsCrawlDelay() = %v, want 1s", delay)
+	}
+
+	// 4xx 视为不限制, 5xx 返回错误
+	site, _ = newRobotsServer(http.StatusNotFound, "")
+	if err = CheckRobots(model.Job{}, target(site, "/private")); err != nil {
+		t.Errorf("CheckRobots() with robots.txt missing error = %v, want allowed", err)
+	}
+	site, _ = newRobotsServer(http.StatusServiceUnavailable, "")
+	if err = CheckRobots(model.Job{}, target(site, "/page")); err == nil {
+		t.Error("CheckRobots() with robots.txt unavailable error = nil, want an error")
+	}
+}
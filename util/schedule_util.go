@@ -0,0 +1,203 @@
+package util
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/robfig/cron/v3"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+var (
+	// reconcileLock 避免多次核对同时进行
+	reconcileLock sync.Mutex
+	// runningJobs 每个任务一把锁, 持有期间表示任务正在执行
+	runningJobs sync.Map
+	// runSlots 全局执行名额的信号量, 首次使用时按配置创建
+	runSlots     chan struct{}
+	runSlotsOnce sync.Once
+	// hostSlots 每个主机一个执行名额的信号量
+	hostSlots sync.Map
+)
+
+// ValidateOverlapPolicy
+// 校验重叠执行策略, 为空时视为 skip
+func ValidateOverlapPolicy(policy string) error {
+	if policy == "" || policy == model.OverlapSkip || policy == model.OverlapDelay {
+		return nil
+	}
+	return fmt.Errorf(config.OverlapPolicyNotFound, policy)
+}
+
+// acquireJobRun
+// 按任务的重叠执行策略获取执行权, skip 策略下上次执行尚未结束时返回 false, delay 策略下等待上次执行结束
+func acquireJobRun(job model.Job) (func(), bool) {
+	lock, _ := runningJobs.LoadOrStore(job.ID, &sync.Mutex{})
+	mutex := lock.(*sync.Mutex)
+	if job.OverlapPolicy == model.OverlapDelay {
+		mutex.Lock()
+	} else if !mutex.TryLock() {
+		return nil, false
+	}
+	return mutex.Unlock, true
+}
+
+// acquireRunSlots
+// 随机延迟后依次等待目标主机及全局的执行名额, 返回释放名额的函数
+// 延迟期间不占用名额, 避免整点触发的大量任务同时抓取; 先取主机名额, 避免等待繁忙主机的任务占满全局名额
+func acquireRunSlots(job model.Job) func() {
+	if config.StartJitter > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(config.StartJitter) * int64(time.Second))))
+	}
+	var releases []func()
+	if config.MaxRunsPerHost > 0 {
+		slots, _ := hostSlots.LoadOrStore(jobHost(job), make(chan struct{}, config.MaxRunsPerHost))
+		hostSlot := slots.(chan struct{})
+		hostSlot <- struct{}{}
+		releases = append(releases, func() { <-hostSlot })
+	}
+	runSlotsOnce.Do(func() {
+		if config.MaxConcurrentRuns > 0 {
+			runSlots = make(chan struct{}, config.MaxConcurrentRuns)
+		}
+	})
+	if runSlots != nil {
+		runSlots <- struct{}{}
+		releases = append(releases, func() { <-runSlots })
+	}
+	return func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+}
+
+// jobHost
+// 获取任务目标页面的主机名, 无法解析时返回空字符串, 此类任务共用一组名额
+func jobHost(job model.Job) string {
+	parsed, err := url.Parse(job.Url)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// StartJobReconciler
+// 按配置的间隔在调度器中注册核对任务, 间隔为 0 时不注册
+func StartJobReconciler() error {
+	if config.ReconcileInterval <= 0 {
+		return nil
+	}
+	_, err := config.Cron.AddFunc(fmt.Sprintf("@every %ds", config.ReconcileInterval), func() {
+		repaired, err := ReconcileJobs()
+		if err != nil {
+			glog.Errorf("Reconciling the cron entries failed: %s", err.Error())
+			return
+		}
+		if repaired > 0 {
+			glog.Warningf("Reconciled the cron entries, %d jobs repaired", repaired)
+			PrintAllJobs()
+		}
+	})
+	return err
+}
+
+// ReconcileJobs
+// 核对调度器与数据库中的任务并修复不一致, 返回修复的任务数
+// 运行中的任务应有且仅有一个调度, 其 EntryID 与数据库一致且执行时间与 cron 配置相符, 已删除或停止的任务不应有调度
+func ReconcileJobs() (int, error) {
+	reconcileLock.Lock()
+	defer reconcileLock.Unlock()
+	var jobs []model.Job
+	err := config.DataBase.Find(&jobs).Error
+	if err != nil {
+		return 0, err
+	}
+	// 按任务 ID 归类调度器中的定时任务, 核对任务自身等其他调度不在核对范围内
+	entries := make(map[uint][]cron.Entry)
+	for _, entry := range config.Cron.Entries() {
+		if jobRun, ok := entry.Job.(JobRun); ok {
+			entries[jobRun.JobID] = append(entries[jobRun.JobID], entry)
+		}
+	}
+	repaired := 0
+	for i := range jobs {
+		jobEntries := entries[jobs[i].ID]
+		delete(entries, jobs[i].ID)
+		ok, err := reconcileJob(&jobs[i], jobEntries)
+		if err != nil {
+			// 单个任务修复失败不影响其余任务, 下次核对时重试
+			glog.Errorf("[Job#%d][%s]Reconciling the cron entries failed: %s", jobs[i].ID, jobs[i].Name, err.Error())
+		}
+		if ok {
+			repaired++
+		}
+	}
+	// 剩余调度所属的任务已被删除
+	for jobID, orphans := range entries {
+		glog.Warningf("[Job#%d]Removing %d orphaned cron entries", jobID, len(orphans))
+		for _, entry := range orphans {
+			config.Cron.Remove(entry.ID)
+		}
+		repaired++
+	}
+	return repaired, nil
+}
+
+// reconcileJob
+// 核对单个任务的调度, 返回是否做了修复
+func reconcileJob(job *model.Job, entries []cron.Entry) (bool, error) {
+	infoPrefix := "[Job#%d][%s]"
+	if job.Status != 0 {
+		if len(entries) == 0 && job.EntryID == 0 {
+			return false, nil
+		}
+		glog.Warningf(infoPrefix+"Removing %d cron entries of the stopped job", job.ID, job.Name, len(entries))
+		for _, entry := range entries {
+			config.Cron.Remove(entry.ID)
+		}
+		return true, config.DataBase.Model(job).Update("entry_id", 0).Error
+	}
+	schedule, err := cron.ParseStandard(job.Cron)
+	if err != nil {
+		return false, err
+	}
+	// 保留 EntryID 与数据库一致且执行时间正确的调度, 其余的均为多余的调度
+	var kept cron.EntryID
+	for _, entry := range entries {
+		if entry.ID == cron.EntryID(job.EntryID) && reflect.DeepEqual(entry.Schedule, schedule) {
+			kept = entry.ID
+		}
+	}
+	if kept != 0 && len(entries) == 1 {
+		return false, nil
+	}
+	if kept != 0 {
+		glog.Warningf(infoPrefix+"Removing %d duplicated cron entries", job.ID, job.Name, len(entries)-1)
+		for _, entry := range entries {
+			if entry.ID != kept {
+				config.Cron.Remove(entry.ID)
+			}
+		}
+		return true, nil
+	}
+	glog.Warningf(infoPrefix+"Rescheduling the job, entry id in database: %d, entries in cron: %d",
+		job.ID, job.Name, job.EntryID, len(entries))
+	for _, entry := range entries {
+		config.Cron.Remove(entry.ID)
+	}
+	// 数据库中的 EntryID 可能已属于其他任务, 先行清空, 避免 ScheduleJob 按其移除
+	err = config.DataBase.Model(job).Update("entry_id", 0).Error
+	if err != nil {
+		return true, err
+	}
+	return true, ScheduleJob(job)
+}
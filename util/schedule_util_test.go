@@ -0,0 +1,181 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/robfig/cron/v3"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// setTestCron
+// 使用未启动的调度器作为全局调度器, 测试结束后恢复
+func setTestCron(t *testing.T) {
+	oldCron := config.Cron
+	config.Cron = cron.New()
+	t.Cleanup(func() { config.Cron = oldCron })
+}
+
+// jobEntries
+// 调度器中属于指定任务的调度
+func jobEntries(jobID uint) []cron.Entry {
+	var entries []cron.Entry
+	for _, entry := range config.Cron.Entries() {
+		if jobRun, ok := entry.Job.(JobRun); ok && jobRun.JobID == jobID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func TestReconcileJobs(t *testing.T) {
+	setTestDataBase(t)
+	setTestCron(t)
+	addEntry := func(spec string, jobID uint) cron.EntryID {
+		entryID, err := config.Cron.AddJob(spec, JobRun{JobID: jobID})
+		if err != nil {
+			t.Fatalf("AddJob() error = %v", err)
+		}
+		return entryID
+	}
+
+	// 正常的任务
+	healthy := model.Job{Name: "healthy", Cron: "@every 1h"}
+	config.DataBase.Create(&healthy)
+	healthyEntry := addEntry(healthy.Cron, healthy.ID)
+	config.DataBase.Model(&healthy).Update("entry_id", healthyEntry)
+	// 数据库中的 EntryID 在调度器中不存在
+	missing := model.Job{Name: "missing", Cron: "@every 1h", EntryID: 999}
+	config.DataBase.Create(&missing)
+	// 同一任务有多个调度
+	duplicated := model.Job{Name: "duplicated", Cron: "@every 1h"}
+	config.DataBase.Create(&duplicated)
+	duplicatedEntry := addEntry(duplicated.Cron, duplicated.ID)
+	addEntry(duplicated.Cron, duplicated.ID)
+	config.DataBase.Model(&duplicated).Update("entry_id", duplicatedEntry)
+	// 调度的执行时间与 cron 配置不符
+	stale := model.Job{Name: "stale", Cron: "@every 1h"}
+	config.DataBase.Create(&stale)
+	staleEntry := addEntry("@every 2h", stale.ID)
+	config.DataBase.Model(&stale).Update("entry_id", staleEntry)
+	// 已停止的任务仍有调度
+	stopped := model.Job{Name: "stopped", Cron: "@every 1h", Status: 1}
+	config.DataBase.Create(&stopped)
+	stoppedEntry := addEntry(stopped.Cron, stopped.ID)
+	config.DataBase.Model(&stopped).Update("entry_id", stoppedEntry)
+	// 已删除的任务仍有调度
+	addEntry("@every 1h", 1000)
+	// 核对任务自身等其他调度不在核对范围内
+	otherEntry, _ := config.Cron.AddFunc("@every 1m", func() {})
+
+	repaired, err := ReconcileJobs()
+	if err != nil {
+		t.Fatalf("ReconcileJobs() error = %v", err)
+	}
+	if repaired != 5 {
+		t.Errorf("ReconcileJobs() repaired %d jobs, want 5", repaired)
+	}
+	for _, job := range []model.Job{healthy, missing, duplicated, stale} {
+		var stored model.Job
+		config.DataBase.First(&stored, job.ID)
+		entries := jobEntries(job.ID)
+		if len(entries) != 1 || int(entries[0].ID) != stored.EntryID {
+			t.Errorf("%s: %d entries, entry id in database %d, want one matching entry", job.Name, len(entries), stored.EntryID)
+			continue
+		}
+		schedule, _ := cron.ParseStandard(job.Cron)
+		if entries[0].Schedule.Next(stored.CreatedAt) != schedule.Next(stored.CreatedAt) {
+			t.Errorf("%s: the entry does not follow the cron spec %s", job.Name, job.Cron)
+		}
+	}
+	var stored model.Job
+	config.DataBase.First(&stored, healthy.ID)
+	if stored.EntryID != int(healthyEntry) {
+		t.Errorf("healthy: entry id = %d, want the entry %d kept", stored.EntryID, healthyEntry)
+	}
+	stored = model.Job{}
+	config.DataBase.First(&stored, duplicated.ID)
+	if stored.EntryID != int(duplicatedEntry) {
+		t.Errorf("duplicated: entry id = %d, want the entry %d kept", stored.EntryID, duplicatedEntry)
+	}
+	stored = model.Job{}
+	config.DataBase.First(&stored, stopped.ID)
+	if len(jobEntries(stopped.ID)) != 0 || stored.EntryID != 0 {
+		t.Errorf("stopped: %d entries, entry id %d, want none", len(jobEntries(stopped.ID)), stored.EntryID)
+	}
+	if len(jobEntries(1000)) != 0 {
+		t.Error("the entry of the deleted job was not removed")
+	}
+	if config.Cron.Entry(otherEntry).ID != otherEntry {
+		t.Error("an entry that is not a job run was removed")
+	}
+
+	// 修复后再次核对无需修复
+	if repaired, err = ReconcileJobs(); repaired != 0 || err != nil {
+		t.Errorf("ReconcileJobs() again = %d, %v, want nothing to repair", repaired, err)
+	}
+}
+
+func TestAcquireJobRun(t *testing.T) {
+	job := model.Job{Model: gorm.Model{ID: 1001}, OverlapPolicy: model.OverlapSkip}
+	t.Cleanup(func() { runningJobs.Delete(job.ID) })
+	release, ok := acquireJobRun(job)
+	if !ok {
+		t.Fatal("acquireJobRun() = false, want the first run to start")
+	}
+	// skip 策略下上次执行尚未结束时跳过
+	if _, ok = acquireJobRun(job); ok {
+		t.Error("acquireJobRun() with skip = true while the job is running, want false")
+	}
+	// delay 策略下等待上次执行结束
+	job.OverlapPolicy = model.OverlapDelay
+	started := make(chan func())
+	go func() {
+		release, _ := acquireJobRun(job)
+		started <- release
+	}()
+	select {
+	case <-started:
+		t.Fatal("acquireJobRun() with delay returned while the job is running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case release = <-started:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("acquireJobRun() with delay did not start after the previous run finished")
+	}
+}
+
+func TestAcquireRunSlotsPerHost(t *testing.T) {
+	oldPerHost, oldJitter := config.MaxRunsPerHost, config.StartJitter
+	config.MaxRunsPerHost, config.StartJitter = 1, 0
+	t.Cleanup(func() {
+		config.MaxRunsPerHost, config.StartJitter = oldPerHost, oldJitter
+		hostSlots.Delete("slots.example.com")
+	})
+	job := model.Job{Url: "https://Slots.example.com/a"}
+	release := acquireRunSlots(job)
+	// 其他主机不受影响
+	acquireRunSlots(model.Job{Url: "https://other-slots.example.com/"})()
+	hostSlots.Delete("other-slots.example.com")
+
+	acquired := make(chan func())
+	go func() { acquired <- acquireRunSlots(model.Job{Url: "https://slots.example.com/b"}) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquireRunSlots() returned while the host slot is taken")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case release = <-acquired:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("acquireRunSlots() did not return after the host slot was released")
+	}
+}
@@ -0,0 +1,289 @@
+package util
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// 数据库迁移使用的冻结表结构, 与 model 中的结构体相互独立
+// 每个版本只描述其新建的表或新增的列, 发布后不可修改, 之后的表结构变更须在新版本中另行定义
+
+// schemaV0Account
+// 迁移机制引入前即已存在的 accounts 表
+type schemaV0Account struct {
+	gorm.Model
+	Email    string `gorm:"not null; unique"`
+	Password string `gorm:"not null"`
+	SMTPHost string `gorm:"type:varchar(256)"`
+	SMTPPort int    `gorm:"type:int"`
+	Status   int    `gorm:"type:int"`
+}
+
+func (schemaV0Account) TableName() string { return "accounts" }
+
+// schemaV0Job
+// 迁移机制引入前即已存在的 jobs 表
+type schemaV0Job struct {
+	gorm.Model
+	Name          string `gorm:"not null; unique"`
+	Cron          string
+	EntryID       int    `gorm:"not null"`
+	Url           string `gorm:"type:varchar(512)"`
+	OldValue      string `gorm:"type:varchar(2048)"`
+	Pattern       string `gorm:"type:varchar(1024)"`
+	PatternStatus int    `gorm:"type:int"`
+	Email         string `gorm:"not null"`
+	Content       string `gorm:"type:varchar(2048)"`
+	Status        int    `gorm:"type:int"`
+}
+
+func (schemaV0Job) TableName() string { return "jobs" }
+
+// schemaV0Template
+// 迁移机制引入前即已存在的 templates 表, 定时配置列名误写为 corn
+type schemaV0Template struct {
+	gorm.Model
+	Name    string `gorm:"not null; unique"`
+	Corn    string
+	Pattern string `gorm:"type:varchar(1024)"`
+	Content string `gorm:"type:varchar(2048)"`
+}
+
+func (schemaV0Template) TableName() string { return "templates" }
+
+// schemaV1Job
+// 版本 1 新增的 jobs 列
+type schemaV1Job struct {
+	PatternType       string `gorm:"type:varchar(32)"`
+	MultiMatch        bool
+	AccountID         uint   `gorm:"index"`
+	Recipients        string `gorm:"type:varchar(2048)"`
+	CC                string `gorm:"type:varchar(2048)"`
+	BCC               string `gorm:"type:varchar(2048)"`
+	RecipientGroupIDs string `gorm:"type:varchar(256)"`
+	Subject           string `gorm:"type:varchar(512)"`
+	ChannelIDs        string `gorm:"type:varchar(256)"`
+	TemplateID        uint   `gorm:"index"`
+}
+
+func (schemaV1Job) TableName() string { return "jobs" }
+
+// schemaV1Template
+// 版本 1 新增的 templates 列
+type schemaV1Template struct {
+	PatternType string `gorm:"type:varchar(32)"`
+	MultiMatch  bool
+	Subject     string `gorm:"type:varchar(512)"`
+}
+
+func (schemaV1Template) TableName() string { return "templates" }
+
+// schemaV1RunRecord
+// 版本 1 的 run_records 表
+type schemaV1RunRecord struct {
+	gorm.Model
+	JobID         uint      `gorm:"not null; index"`
+	StartTime     time.Time `gorm:"index"`
+	EndTime       time.Time
+	FetchDuration int64  `gorm:"type:bigint"`
+	HTTPStatus    int    `gorm:"type:int"`
+	BytesFetched  int    `gorm:"type:int"`
+	Value         string `gorm:"type:varchar(2048)"`
+	Changed       bool
+	Status        string `gorm:"type:varchar(32); index"`
+	NotifyStatus  string `gorm:"type:varchar(32)"`
+	Error         string `gorm:"type:varchar(2048)"`
+}
+
+func (schemaV1RunRecord) TableName() string { return "run_records" }
+
+// schemaV1ValueChange
+// 版本 1 的 value_changes 表
+type schemaV1ValueChange struct {
+	gorm.Model
+	JobID       uint      `gorm:"not null; index"`
+	Value       string    `gorm:"type:varchar(2048)"`
+	Hash        string    `gorm:"type:varchar(64)"`
+	DetectedAt  time.Time `gorm:"index"`
+	RunRecordID uint      `gorm:"index"`
+}
+
+func (schemaV1ValueChange) TableName() string { return "value_changes" }
+
+// schemaV1Channel
+// 版本 1 的 channels 表
+type schemaV1Channel struct {
+	gorm.Model
+	Name    string `gorm:"not null; unique"`
+	Type    string `gorm:"type:varchar(32)"`
+	Url     string `gorm:"type:varchar(512)"`
+	Method  string `gorm:"type:varchar(16)"`
+	Headers string `gorm:"type:varchar(2048)"`
+	Body    string `gorm:"type:varchar(4096)"`
+	Token   string `gorm:"type:varchar(256)"`
+	ChatID  string `gorm:"type:varchar(128)"`
+	Secret  string `gorm:"type:varchar(256)"`
+	Status  int    `gorm:"type:int"`
+}
+
+func (schemaV1Channel) TableName() string { return "channels" }
+
+// schemaV1RecipientGroup
+// 版本 1 的 recipient_groups 表
+type schemaV1RecipientGroup struct {
+	gorm.Model
+	Name       string `gorm:"not null; unique"`
+	Recipients string `gorm:"type:varchar(2048)"`
+	CC         string `gorm:"type:varchar(2048)"`
+	BCC        string `gorm:"type:varchar(2048)"`
+}
+
+func (schemaV1RecipientGroup) TableName() string { return "recipient_groups" }
+
+// schemaV2Job
+// 版本 2 新增的 jobs 列
+type schemaV2Job struct {
+	FetchMode    string `gorm:"type:varchar(32)"`
+	WaitSelector string `gorm:"type:varchar(512)"`
+}
+
+func (schemaV2Job) TableName() string { return "jobs" }
+
+// schemaV3Job
+// 版本 3 新增的 jobs 列
+type schemaV3Job struct {
+	Method       string `gorm:"type:varchar(16)"`
+	Headers      string `gorm:"type:varchar(2048)"`
+	Query        string `gorm:"type:varchar(1024)"`
+	Body         string `gorm:"type:varchar(4096)"`
+	Cookies      string `gorm:"type:varchar(2048)"`
+	NoRedirect   bool
+	MaxRedirects int `gorm:"type:int"`
+}
+
+func (schemaV3Job) TableName() string { return "jobs" }
+
+// schemaV4Session
+// 版本 4 的 sessions 表
+type schemaV4Session struct {
+	gorm.Model
+	Name         string `gorm:"not null; unique"`
+	Steps        string `gorm:"type:varchar(8192)"`
+	Username     string `gorm:"type:varchar(256)"`
+	Password     string `gorm:"type:varchar(1024)"`
+	Cookies      string `gorm:"type:varchar(8192)"`
+	ExpireMarker string `gorm:"type:varchar(512)"`
+	ExpireStatus string `gorm:"type:varchar(128)"`
+	LoggedInAt   *time.Time
+}
+
+func (schemaV4Session) TableName() string { return "sessions" }
+
+// schemaV4Job
+// 版本 4 新增的 jobs 列
+type schemaV4Job struct {
+	SessionID uint `gorm:"index"`
+}
+
+func (schemaV4Job) TableName() string { return "jobs" }
+
+// schemaV5Job
+// 版本 5 新增的 jobs 列
+type schemaV5Job struct {
+	Proxy         string `gorm:"type:varchar(1024)"`
+	SkipTLSVerify bool
+}
+
+func (schemaV5Job) TableName() string { return "jobs" }
+
+// schemaV6RunRecord
+// 版本 6 新增的 run_records 列
+type schemaV6RunRecord struct {
+	FailureType string `gorm:"type:varchar(32); index"`
+	Attempts    int    `gorm:"type:int"`
+}
+
+func (schemaV6RunRecord) TableName() string { return "run_records" }
+
+// schemaV7Job
+// 版本 7 新增的 jobs 列
+type schemaV7Job struct {
+	FailureThreshold int `gorm:"type:int"`
+	FailureStreak    int `gorm:"type:int"`
+	FailureAlerted   bool
+}
+
+func (schemaV7Job) TableName() string { return "jobs" }
+
+// schemaV8Job
+// 版本 8 新增的 jobs 列
+type schemaV8Job struct {
+	TriggerRules      string `gorm:"type:varchar(2048)"`
+	TriggerExpression string `gorm:"type:varchar(512)"`
+	NumberLocale      string `gorm:"type:varchar(16)"`
+}
+
+func (schemaV8Job) TableName() string { return "jobs" }
+
+// schemaV9Job
+// 版本 9 新增的 jobs 列
+type schemaV9Job struct {
+	Normalizers string `gorm:"type:varchar(2048)"`
+}
+
+func (schemaV9Job) TableName() string { return "jobs" }
+
+// schemaV10Job
+// 版本 10 新增的 jobs 列
+type schemaV10Job struct {
+	MonitorMode string `gorm:"type:varchar(16)"`
+	Region      string `gorm:"type:varchar(512)"`
+	IgnoreLines string `gorm:"type:varchar(2048)"`
+}
+
+func (schemaV10Job) TableName() string { return "jobs" }
+
+// schemaV11Job
+// 版本 11 新增的 jobs 列
+type schemaV11Job struct {
+	MaxDownloadSize int64
+	TrustValidators bool
+	ContentSize     int64
+	ETag            string `gorm:"column:etag; type:varchar(512)"`
+	LastModified    string `gorm:"type:varchar(64)"`
+}
+
+func (schemaV11Job) TableName() string { return "jobs" }
+
+// schemaV12Job
+// 版本 12 新增的 jobs 列
+type schemaV12Job struct {
+	NoConditionalGet bool
+}
+
+func (schemaV12Job) TableName() string { return "jobs" }
+
+// schemaV13Job
+// 版本 13 新增的 jobs 列
+type schemaV13Job struct {
+	OverlapPolicy string `gorm:"type:varchar(16)"`
+}
+
+func (schemaV13Job) TableName() string { return "jobs" }
+
+// schemaV14Job
+// 版本 14 新增的 jobs 列
+type schemaV14Job struct {
+	IgnoreRobots bool
+}
+
+func (schemaV14Job) TableName() string { return "jobs" }
+
+// schemaV15Job
+// 版本 15 新增的 jobs 列
+type schemaV15Job struct {
+	TriggerValue string `gorm:"type:text"`
+}
+
+func (schemaV15Job) TableName() string { return "jobs" }
@@ -0,0 +1,391 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// sessionLocks 每个登录会话一把锁, 避免共用会话的任务同时重新登录
+var sessionLocks sync.Map
+
+// sessionCookie
+// 加密存储的 Cookie 条目, 仅保留名称和值, 使用时附加到任务的请求地址上
+type sessionCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ParseSessionSteps
+// 解析 JSON 数组形式的登录步骤
+func ParseSessionSteps(steps string) ([]model.SessionStep, error) {
+	var parsed []model.SessionStep
+	err := json.Unmarshal([]byte(steps), &parsed)
+	if err != nil {
+		return nil, fmt.Errorf(config.SessionStepsInvalid, err)
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf(config.SessionStepsInvalid, "empty")
+	}
+	return parsed, nil
+}
+
+// ValidateSession
+// 校验登录步骤、失效标记及失效状态码
+func ValidateSession(session model.Session) error {
+	steps, err := ParseSessionSteps(session.Steps)
+	if err != nil {
+		return err
+	}
+	for i, step := range steps {
+		if strings.TrimSpace(step.Url) == "" {
+			return fmt.Errorf(config.SessionStepUrlEmpty, i+1)
+		}
+		if _, err = jobRequestMethod(step.Method); err != nil {
+			return err
+		}
+		for _, text := range append([]string{step.Url, step.Body}, headerValues(step.Headers)...) {
+			if _, err = newStepTemplate(text); err != nil {
+				return err
+			}
+		}
+		for _, extract := range step.Extract {
+			if extract.Name == "" {
+				return fmt.Errorf(config.SessionExtractNameEmpty, i+1)
+			}
+			if _, err = GetExtractor(extract.PatternType); err != nil {
+				return err
+			}
+		}
+	}
+	if session.ExpireMarker != "" {
+		if _, err = regexp.Compile(session.ExpireMarker); err != nil {
+			return err
+		}
+	}
+	_, err = parseExpireStatus(session.ExpireStatus)
+	return err
+}
+
+// LoadSessionCookies
+// 获取任务所用登录会话的 Cookie, 尚未登录时以该任务的网络配置先行登录
+func LoadSessionCookies(session *model.Session, job model.Job) ([]*http.Cookie, error) {
+	lock := sessionLock(session.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	// 其他任务可能已完成登录, 以数据库中的最新值为准
+	err := config.DataBase.Where(config.IDEqual, session.ID).First(session).Error
+	if err != nil {
+		return nil, err
+	}
+	if session.Cookies == "" {
+		return loginSession(session, job)
+	}
+	return decryptSessionCookies(session.Cookies)
+}
+
+// ReloginSession
+// 会话失效后重新登录, 若其他任务已在 since 之后重新登录则直接使用其结果
+func ReloginSession(session *model.Session, job model.Job, since time.Time) ([]*http.Cookie, error) {
+	lock := sessionLock(session.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	err := config.DataBase.Where(config.IDEqual, session.ID).First(session).Error
+	if err != nil {
+		return nil, err
+	}
+	if session.Cookies != "" && session.LoggedInAt != nil && session.LoggedInAt.After(since) {
+		return decryptSessionCookies(session.Cookies)
+	}
+	return loginSession(session, job)
+}
+
+// LoginSession
+// 立即以全局网络配置执行登录步骤并保存得到的 Cookie
+func LoginSession(session *model.Session) ([]*http.Cookie, error) {
+	lock := sessionLock(session.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	return loginSession(session, model.Job{})
+}
+
+// loginSession
+// 依次执行登录步骤, 步骤间共用同一个 Cookie Jar, 完成后加密保存所有步骤得到的 Cookie, 调用方需持有会话锁
+func loginSession(session *model.Session, job model.Job) ([]*http.Cookie, error) {
+	steps, err := ParseSessionSteps(session.Steps)
+	if err != nil {
+		return nil, err
+	}
+	password, err := DecryptSecret(session.Password)
+	if err != nil {
+		return nil, err
+	}
+	variables := map[string]string{
+		model.SessionUsername: session.Username,
+		model.SessionPassword: password,
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	// 使用触发登录的任务的代理及 TLS 配置, 保证登录与抓取的出口一致
+	client, err := NewFetchClient(job, jar, nil)
+	if err != nil {
+		return nil, err
+	}
+	var cookies []*http.Cookie
+	cookieIndex := make(map[string]int)
+	for i, step := range steps {
+		request, err := buildStepRequest(step, variables)
+		if err != nil {
+			return nil, err
+		}
+		body, err := doStepRequest(client, request, i+1)
+		if err != nil {
+			return nil, err
+		}
+		for _, extract := range step.Extract {
+			value, err := ExtractTarget(body, extract.PatternType, extract.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf(config.SessionExtractFail, i+1, extract.Name, err)
+			}
+			variables[extract.Name] = value
+		}
+		// 收集当前步骤地址下可见的 Cookie, 同名时以后出现的为准
+		for _, cookie := range jar.Cookies(request.URL) {
+			if index, ok := cookieIndex[cookie.Name]; ok {
+				cookies[index] = cookie
+				continue
+			}
+			cookieIndex[cookie.Name] = len(cookies)
+			cookies = append(cookies, cookie)
+		}
+	}
+	encrypted, err := encryptSessionCookies(cookies)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = config.DataBase.Model(session).Updates(map[string]interface{}{
+		"cookies":      encrypted,
+		"logged_in_at": &now,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	session.Cookies = encrypted
+	session.LoggedInAt = &now
+	return cookies, nil
+}
+
+// buildStepRequest
+// 渲染登录步骤中的模板并构建请求
+func buildStepRequest(step model.SessionStep, variables map[string]string) (*http.Request, error) {
+	method, err := jobRequestMethod(step.Method)
+	if err != nil {
+		return nil, err
+	}
+	stepUrl, err := renderStepTemplate(step.Url, variables)
+	if err != nil {
+		return nil, err
+	}
+	body, err := renderStepTemplate(step.Body, variables)
+	if err != nil {
+		return nil, err
+	}
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	request, err := http.NewRequest(method, stepUrl, reader)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", config.UserAgent)
+	if body != "" {
+		request.Header.Set("Content-Type", guessContentType(body))
+	}
+	for key, value := range step.Headers {
+		value, err = renderStepTemplate(value, variables)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set(key, value)
+	}
+	return request, nil
+}
+
+// doStepRequest
+// 执行登录步骤请求, 返回转码后的响应体, 响应状态码不低于 400 时视为失败
+func doStepRequest(client *http.Client, request *http.Request, index int) ([]byte, error) {
+	// 登录步骤与抓取共用主机限流
+	err := WaitHost(context.Background(), request.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf(config.SessionStepFail, index, response.StatusCode)
+	}
+	return DataEncoding(response.Body)
+}
+
+// newStepTemplate
+// 解析登录步骤中的模板, 引用未定义的变量时报错, 表单中可用 urlquery、JSON 中可用 json 转义变量
+func newStepTemplate(text string) (*template.Template, error) {
+	return template.New("step").Option("missingkey=error").Funcs(template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			res, err := json.Marshal(value)
+			return string(res), err
+		},
+	}).Parse(text)
+}
+
+// renderStepTemplate
+// 以用户名、密码及已提取的变量渲染登录步骤中的模板
+func renderStepTemplate(text string, variables map[string]string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := newStepTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	var buffer bytes.Buffer
+	err = tmpl.Execute(&buffer, variables)
+	if err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// headerValues
+// 返回请求头的所有值
+func headerValues(headers map[string]string) []string {
+	values := make([]string, 0, len(headers))
+	for _, value := range headers {
+		values = append(values, value)
+	}
+	return values
+}
+
+// SessionExpired
+// 根据失效状态码及失效标记判断抓取结果是否表明会话已失效
+func SessionExpired(session model.Session, page FetchResult) bool {
+	statuses, err := parseExpireStatus(session.ExpireStatus)
+	if err == nil {
+		for _, status := range statuses {
+			if page.StatusCode == status {
+				return true
+			}
+		}
+	}
+	if session.ExpireMarker != "" {
+		marker, err := regexp.Compile(session.ExpireMarker)
+		if err == nil && marker.Match(page.Body) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseExpireStatus
+// 解析以逗号分隔的失效状态码
+func parseExpireStatus(expireStatus string) ([]int, error) {
+	var statuses []int
+	for _, item := range strings.Split(expireStatus, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		status, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, fmt.Errorf(config.SessionExpireStatusInvalid, item)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// encryptSessionCookies
+// 将 Cookie 序列化后加密
+func encryptSessionCookies(cookies []*http.Cookie) (string, error) {
+	entries := make([]sessionCookie, 0, len(cookies))
+	for _, cookie := range cookies {
+		entries = append(entries, sessionCookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	content, err := json.Marshal(entries)
+	if err != nil {
+		return "", err
+	}
+	return EncryptSecret(string(content))
+}
+
+// decryptSessionCookies
+// 解密并反序列化 Cookie
+func decryptSessionCookies(encrypted string) ([]*http.Cookie, error) {
+	content, err := DecryptSecret(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	var entries []sessionCookie
+	err = json.Unmarshal([]byte(content), &entries)
+	if err != nil {
+		return nil, err
+	}
+	cookies := make([]*http.Cookie, 0, len(entries))
+	for _, entry := range entries {
+		cookies = append(cookies, &http.Cookie{Name: entry.Name, Value: entry.Value})
+	}
+	return cookies, nil
+}
+
+// sessionLock
+// 获取登录会话对应的锁
+func sessionLock(sessionID uint) *sync.Mutex {
+	lock, _ := sessionLocks.LoadOrStore(sessionID, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// FetchJobPageWithSession
+// 携带登录会话的 Cookie 抓取页面, 检测到会话失效时重新登录并重试一次
+func FetchJobPageWithSession(job model.Job) (FetchResult, error) {
+	var session model.Session
+	session.ID = job.SessionID
+	cookies, err := LoadSessionCookies(&session, job)
+	if err != nil {
+		return FetchResult{}, fmt.Errorf(config.SessionLoginFail, session.Name, err)
+	}
+	fetchStart := time.Now()
+	page, err := fetchJobPageOnce(job, cookies)
+	if err != nil || !SessionExpired(session, page) {
+		return page, err
+	}
+	cookies, err = ReloginSession(&session, job, fetchStart)
+	if err != nil {
+		return page, fmt.Errorf(config.SessionLoginFail, session.Name, err)
+	}
+	page, err = fetchJobPageOnce(job, cookies)
+	if err == nil && SessionExpired(session, page) {
+		return page, errors.New(config.SessionStillExpired)
+	}
+	return page, err
+}
@@ -0,0 +1,60 @@
+package util
+
+import (
+	"github.com/robfig/cron/v3"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// ApplyTemplate
+// 将任务模板中的定时配置、抓取规则及通知模板覆盖到任务上, 并关联该模板
+func ApplyTemplate(job *model.Job, template model.Template) {
+	job.TemplateID = template.ID
+	job.Cron = template.Cron
+	job.Pattern = template.Pattern
+	job.PatternType = template.PatternType
+	job.MultiMatch = template.MultiMatch
+	job.Subject = template.Subject
+	job.Content = template.Content
+}
+
+// ValidateTemplateCron
+// 校验任务模板的定时配置是否能被调度器解析
+func ValidateTemplateCron(template model.Template) error {
+	_, err := cron.ParseStandard(template.Cron)
+	return err
+}
+
+// SyncJobsFromTemplate
+// 将任务模板的修改同步到所有关联的任务, 并在调度器中重新注册, 返回同步的任务数
+func SyncJobsFromTemplate(template model.Template) (int, error) {
+	var jobs []model.Job
+	err := config.DataBase.Where(config.TemplateIDEqual, template.ID).Find(&jobs).Error
+	if err != nil {
+		return 0, err
+	}
+	for i := range jobs {
+		ApplyTemplate(&jobs[i], template)
+		// 模板字段的零值同样需要同步, 因此逐列更新; 抓取规则可能已修改, 清空校验头使下次执行完整抓取页面
+		err = config.DataBase.Model(&jobs[i]).Updates(map[string]interface{}{
+			"cron":          jobs[i].Cron,
+			"pattern":       jobs[i].Pattern,
+			"pattern_type":  jobs[i].PatternType,
+			"multi_match":   jobs[i].MultiMatch,
+			"subject":       jobs[i].Subject,
+			"content":       jobs[i].Content,
+			"etag":          "",
+			"last_modified": "",
+		}).Error
+		if err != nil {
+			return i, err
+		}
+		err = ScheduleJob(&jobs[i])
+		if err != nil {
+			return i, err
+		}
+	}
+	PrintAllJobs()
+	return len(jobs), nil
+}
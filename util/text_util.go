@@ -0,0 +1,64 @@
+package util
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// htmlBlockTags 块级元素, 转换为纯文本时在其前后换行
+var htmlBlockTags = map[string]bool{
+	"br": true, "p": true, "div": true, "li": true, "tr": true, "table": true, "ul": true, "ol": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "section": true, "article": true,
+	"header": true, "footer": true, "blockquote": true, "pre": true, "hr": true,
+}
+
+// htmlSkipTags 转换为纯文本时忽略其内容的元素
+var htmlSkipTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "head": true, "template": true,
+}
+
+// HtmlToText
+// 将 html 转换为可读的纯文本, 块级元素按行分隔, 忽略脚本和样式, 去除每行首尾空白及空行
+func HtmlToText(content []byte) string {
+	var builder strings.Builder
+	tokenizer := html.NewTokenizer(bytes.NewReader(content))
+	skipDepth := 0
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			// 读取结束 (io.EOF) 或内容有误, 均停止解析
+			break
+		}
+		token := tokenizer.Token()
+		switch tokenType {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if htmlSkipTags[token.Data] && tokenType == html.StartTagToken {
+				skipDepth++
+			}
+			if htmlBlockTags[token.Data] {
+				builder.WriteString("\n")
+			}
+		case html.EndTagToken:
+			if htmlSkipTags[token.Data] && skipDepth > 0 {
+				skipDepth--
+			}
+			if htmlBlockTags[token.Data] {
+				builder.WriteString("\n")
+			}
+		case html.TextToken:
+			if skipDepth == 0 {
+				builder.WriteString(token.Data)
+			}
+		}
+	}
+	var lines []string
+	for _, line := range strings.Split(builder.String(), "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,424 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"surveillance-guy/config"
+	"surveillance-guy/model"
+)
+
+// numberPattern 匹配抓取值中的第一个数值, 数字之间可夹杂千分位及小数分隔符
+var numberPattern = regexp.MustCompile(`([-−]?)[ \x{00a0}]*(\d(?:[\d.,'’ \x{00a0}\x{202f}]*\d)?)`)
+
+// currencySymbols 货币符号, 解析前去除以便识别 -$12 这类写法中的负号
+var currencySymbols = regexp.MustCompile(`\p{Sc}`)
+
+// numberGroupSeparators 只会用作千分位分隔符的字符
+var numberGroupSeparators = strings.NewReplacer("'", "", "’", "", " ", "", "\u00a0", "", "\u202f", "")
+
+// commaDecimalLocales 以逗号作为小数点的语言
+var commaDecimalLocales = map[string]bool{
+	"de": true, "fr": true, "es": true, "it": true, "pt": true, "ru": true, "nl": true, "pl": true, "tr": true,
+	"sv": true, "da": true, "fi": true, "nb": true, "no": true, "cs": true, "sk": true, "uk": true, "id": true,
+	"vi": true, "ro": true, "hu": true, "el": true, "eu": true,
+}
+
+// triggerExpression
+// 解析后的触发表达式, 根据各规则的结果计算是否触发
+type triggerExpression func(results map[string]bool) bool
+
+// ParseTriggerRules
+// 解析 JSON 数组形式的触发规则, 未命名的规则按顺序命名为 r1、r2 ...
+func ParseTriggerRules(rules string) ([]model.TriggerRule, error) {
+	var parsed []model.TriggerRule
+	if strings.TrimSpace(rules) == "" {
+		return parsed, nil
+	}
+	err := json.Unmarshal([]byte(rules), &parsed)
+	if err != nil {
+		return nil, fmt.Errorf(config.TriggerRulesInvalid, err)
+	}
+	for i := range parsed {
+		if parsed[i].Name == "" {
+			parsed[i].Name = "r" + strconv.Itoa(i+1)
+		}
+	}
+	return parsed, nil
+}
+
+// ValidateTriggers
+// 校验任务的触发规则及触发表达式
+func ValidateTriggers(job model.Job) error {
+	rules, err := ParseTriggerRules(job.TriggerRules)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if names[rule.Name] {
+			return fmt.Errorf(config.TriggerNameDuplicate, rule.Name)
+		}
+		names[rule.Name] = true
+		err = validateTriggerRule(rule)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = parseTriggerExpression(job.TriggerExpression, names)
+	return err
+}
+
+// validateTriggerRule
+// 校验单条触发规则的运算符及比较值
+func validateTriggerRule(rule model.TriggerRule) error {
+	var err error
+	switch rule.Op {
+	case model.TriggerLess, model.TriggerLessEqual, model.TriggerGreater, model.TriggerGreaterEqual,
+		model.TriggerEqual, model.TriggerNotEqual, model.TriggerCrossBelow, model.TriggerCrossAbove, model.TriggerCross:
+		_, err = strconv.ParseFloat(strings.TrimSpace(rule.Value), 64)
+	case model.TriggerPercent:
+		_, err = parsePercent(rule.Value)
+	case model.TriggerRegex:
+		_, err = regexp.Compile(rule.Value)
+	case model.TriggerContains, model.TriggerNotContains:
+	default:
+		return fmt.Errorf(config.TriggerOpInvalid, rule.Op)
+	}
+	if err != nil {
+		return fmt.Errorf(config.TriggerValueInvalid, rule.Name, rule.Value, err)
+	}
+	return nil
+}
+
+// EvaluateTriggers
+// 根据任务的触发规则判断值的变动是否需要通知, 未设置规则时总是通知
+func EvaluateTriggers(job model.Job, oldValue, newValue string) (bool, error) {
+	rules, err := ParseTriggerRules(job.TriggerRules)
+	if err != nil || len(rules) == 0 {
+		return err == nil, err
+	}
+	names := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		names[rule.Name] = true
+	}
+	expression, err := parseTriggerExpression(job.TriggerExpression, names)
+	if err != nil {
+		return false, err
+	}
+	results := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		results[rule.Name], err = evaluateTriggerRule(rule, oldValue, newValue, job.NumberLocale)
+		if err != nil {
+			return false, err
+		}
+	}
+	return expression(results), nil
+}
+
+// evaluateTriggerRule
+// 计算单条触发规则, 新值无法解析出数值时数值类规则不满足, 如 "售罄" 不报错以免影响其他规则的组合
+// 旧值无法解析时穿越及变化幅度类规则同样不满足
+func evaluateTriggerRule(rule model.TriggerRule, oldValue, newValue, locale string) (bool, error) {
+	switch rule.Op {
+	case model.TriggerContains:
+		return strings.Contains(newValue, rule.Value), nil
+	case model.TriggerNotContains:
+		return !strings.Contains(newValue, rule.Value), nil
+	case model.TriggerRegex:
+		pattern, err := regexp.Compile(rule.Value)
+		if err != nil {
+			return false, err
+		}
+		return pattern.MatchString(newValue), nil
+	}
+	newNumber, err := ParseNumber(newValue, locale)
+	if err != nil {
+		return false, nil
+	}
+	oldNumber, oldErr := ParseNumber(oldValue, locale)
+	if rule.Op == model.TriggerPercent {
+		percent, err := parsePercent(rule.Value)
+		if err != nil || oldErr != nil {
+			return false, err
+		}
+		// 旧值为 0 时任何变化都视为无穷大的幅度
+		var change float64
+		switch {
+		case oldNumber != 0:
+			change = (newNumber - oldNumber) / math.Abs(oldNumber) * 100
+		case newNumber > 0:
+			change = math.Inf(1)
+		case newNumber < 0:
+			change = math.Inf(-1)
+		}
+		switch {
+		case strings.HasPrefix(strings.TrimSpace(rule.Value), "+"):
+			return change >= percent, nil
+		case percent < 0:
+			return change <= percent, nil
+		default:
+			return math.Abs(change) >= percent, nil
+		}
+	}
+	target, err := strconv.ParseFloat(strings.TrimSpace(rule.Value), 64)
+	if err != nil {
+		return false, err
+	}
+	switch rule.Op {
+	case model.TriggerLess:
+		return newNumber < target, nil
+	case model.TriggerLessEqual:
+		return newNumber <= target, nil
+	case model.TriggerGreater:
+		return newNumber > target, nil
+	case model.TriggerGreaterEqual:
+		return newNumber >= target, nil
+	case model.TriggerEqual:
+		return newNumber == target, nil
+	case model.TriggerNotEqual:
+		return newNumber != target, nil
+	}
+	if oldErr != nil {
+		return false, nil
+	}
+	below := oldNumber >= target && newNumber < target
+	above := oldNumber <= target && newNumber > target
+	switch rule.Op {
+	case model.TriggerCrossBelow:
+		return below, nil
+	case model.TriggerCrossAbove:
+		return above, nil
+	case model.TriggerCross:
+		return below || above, nil
+	}
+	return false, fmt.Errorf(config.TriggerOpInvalid, rule.Op)
+}
+
+// parsePercent
+// 解析变化幅度, 允许带 + 号及 % 号
+func parsePercent(value string) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+}
+
+// ParseNumber
+// 从抓取值中解析第一个数值, 忽略货币符号及千分位分隔符
+// locale 决定小数点是 . 还是 , , 为空时根据分隔符的位置自动判断, 如 "$1,234.50"、"1.234,50 €"、"1 234,5"
+func ParseNumber(value string, locale string) (float64, error) {
+	matches := numberPattern.FindStringSubmatch(currencySymbols.ReplaceAllString(value, ""))
+	if matches == nil {
+		return 0, fmt.Errorf(config.NumberParseFail, value)
+	}
+	number := normalizeNumber(numberGroupSeparators.Replace(matches[2]), numberDecimalSeparator(locale))
+	res, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf(config.NumberParseFail, value)
+	}
+	if matches[1] != "" {
+		res = -res
+	}
+	return res, nil
+}
+
+// numberDecimalSeparator
+// 返回区域设置对应的小数点, 未设置时返回 0 表示自动判断
+func numberDecimalSeparator(locale string) rune {
+	if locale == "" {
+		return 0
+	}
+	language, _, _ := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-")
+	if commaDecimalLocales[strings.ToLower(language)] {
+		return ','
+	}
+	return '.'
+}
+
+// normalizeNumber
+// 去除千分位分隔符并将小数点统一为 .
+// 自动判断时, 同时出现 . 和 , 则靠后的为小数点; 只出现一种且出现多次时, 各段均为三位数字则为千分位,
+// 否则不是合法的数值 (如版本号 1.2.3), 只取前两段; 只出现一次且其后恰好三位数字时视为千分位 (整数部分为 0 时除外), 否则为小数点
+func normalizeNumber(number string, decimal rune) string {
+	if decimal == 0 {
+		lastDot, lastComma := strings.LastIndex(number, "."), strings.LastIndex(number, ",")
+		switch {
+		case lastDot >= 0 && lastComma >= 0:
+			decimal = '.'
+			if lastComma > lastDot {
+				decimal = ','
+			}
+		case lastDot >= 0 || lastComma >= 0:
+			separator := "."
+			if lastComma >= 0 {
+				separator = ","
+			}
+			groups := strings.Split(number, separator)
+			decimal = rune(separator[0])
+			if len(groups) > 2 {
+				decimal = 0
+				for _, group := range groups[1:] {
+					if len(group) != 3 {
+						number = groups[0] + separator + groups[1]
+						decimal = rune(separator[0])
+						break
+					}
+				}
+			} else if len(groups[1]) == 3 && strings.TrimLeft(groups[0], "0") != "" {
+				decimal = 0
+			}
+		}
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == decimal:
+			return '.'
+		case unicode.IsDigit(r):
+			return r
+		}
+		return -1
+	}, number)
+}
+
+// parseTriggerExpression
+// 解析组合触发规则的表达式, 支持 && || ! 及括号, 也可写作 and or not, 为空时须满足所有规则
+func parseTriggerExpression(expression string, names map[string]bool) (triggerExpression, error) {
+	if strings.TrimSpace(expression) == "" {
+		return func(results map[string]bool) bool {
+			for _, result := range results {
+				if !result {
+					return false
+				}
+			}
+			return true
+		}, nil
+	}
+	parser := &triggerParser{tokens: tokenizeTriggerExpression(expression), names: names}
+	res, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.position < len(parser.tokens) {
+		return nil, fmt.Errorf(config.TriggerExpressionInvalid, parser.tokens[parser.position])
+	}
+	return res, nil
+}
+
+// tokenizeTriggerExpression
+// 将表达式拆分为运算符、括号及规则名称
+func tokenizeTriggerExpression(expression string) []string {
+	var tokens []string
+	for i := 0; i < len(expression); {
+		switch c := expression[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case strings.HasPrefix(expression[i:], "&&") || strings.HasPrefix(expression[i:], "||"):
+			tokens = append(tokens, expression[i:i+2])
+			i += 2
+		case c == '!' || c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			j := i
+			for j < len(expression) && strings.IndexByte(" \t\n&|!()", expression[j]) < 0 {
+				j++
+			}
+			if j == i {
+				j++
+			}
+			token := expression[i:j]
+			switch strings.ToLower(token) {
+			case "and":
+				token = "&&"
+			case "or":
+				token = "||"
+			case "not":
+				token = "!"
+			}
+			tokens = append(tokens, token)
+			i = j
+		}
+	}
+	return tokens
+}
+
+// triggerParser
+// 触发表达式的递归下降解析器, 优先级从低到高为 || && !
+type triggerParser struct {
+	tokens   []string
+	position int
+	names    map[string]bool
+}
+
+func (p *triggerParser) peek() string {
+	if p.position < len(p.tokens) {
+		return p.tokens[p.position]
+	}
+	return ""
+}
+
+func (p *triggerParser) parseOr() (triggerExpression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.position++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		previous := left
+		left = func(results map[string]bool) bool { return previous(results) || right(results) }
+	}
+	return left, nil
+}
+
+func (p *triggerParser) parseAnd() (triggerExpression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.position++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		previous := left
+		left = func(results map[string]bool) bool { return previous(results) && right(results) }
+	}
+	return left, nil
+}
+
+func (p *triggerParser) parseUnary() (triggerExpression, error) {
+	token := p.peek()
+	p.position++
+	switch token {
+	case "!":
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(results map[string]bool) bool { return !operand(results) }, nil
+	case "(":
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf(config.TriggerExpressionInvalid, p.peek())
+		}
+		p.position++
+		return inner, nil
+	case "", ")", "&&", "||":
+		return nil, fmt.Errorf(config.TriggerExpressionInvalid, token)
+	}
+	if !p.names[token] {
+		return nil, fmt.Errorf(config.TriggerRuleUndefined, token)
+	}
+	return func(results map[string]bool) bool { return results[token] }, nil
+}
@@ -0,0 +1,195 @@
+package util
+
+import (
+	"testing"
+
+	"surveillance-guy/model"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		value  string
+		locale string
+		want   float64
+	}{
+		{"$1,234.50", "", 1234.5},
+		{"1.234,50 €", "", 1234.5},
+		{"1 234,5", "", 1234.5},
+		{"1'234.5 CHF", "", 1234.5},
+		{"-$12", "", -12},
+		{"− 3.5", "", -3.5},
+		{"12,5", "", 12.5},
+		{"0.500", "", 0.5},
+		// 只出现一次且其后恰好三位数字时视为千分位
+		{"1.000", "", 1000},
+		{"1,000", "", 1000},
+		{"1.000", "en", 1},
+		{"1.000,5", "de", 1000.5},
+		{"1,5", "de-DE", 1.5},
+		{"1,5", "en_US", 15},
+		{"1.234.567", "", 1234567},
+		// 版本号不是合法的分组数值, 只取前两段
+		{"v1.2.3", "", 1.2},
+		{"Price: 42 pcs, 7 left", "", 42},
+	}
+	for _, test := range tests {
+		got, err := ParseNumber(test.value, test.locale)
+		if err != nil {
+			t.Errorf("ParseNumber(%q, %q) error = %v", test.value, test.locale, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseNumber(%q, %q) = %v, want %v", test.value, test.locale, got, test.want)
+		}
+	}
+	for _, value := range []string{"", "Sold out", "$"} {
+		if _, err := ParseNumber(value, ""); err == nil {
+			t.Errorf("ParseNumber(%q) error = nil, want an error", value)
+		}
+	}
+}
+
+func TestEvaluateTriggerRule(t *testing.T) {
+	tests := []struct {
+		op, value          string
+		oldValue, newValue string
+		want               bool
+	}{
+		{model.TriggerLess, "100", "120", "99.9", true},
+		{model.TriggerLess, "100", "120", "100", false},
+		{model.TriggerLessEqual, "100", "120", "100", true},
+		{model.TriggerGreater, "100", "", "101", true},
+		{model.TriggerGreaterEqual, "100", "", "99", false},
+		{model.TriggerEqual, "100", "", "$100.00", true},
+		{model.TriggerNotEqual, "100", "", "100", false},
+		// 新值无法解析出数值时数值类规则不满足
+		{model.TriggerLess, "100", "120", "Sold out", false},
+		{model.TriggerPercent, "5", "100", "Sold out", false},
+		{model.TriggerPercent, "10", "100", "110", true},
+		{model.TriggerPercent, "10", "100", "90", true},
+		{model.TriggerPercent, "10", "100", "95", false},
+		{model.TriggerPercent, "-10", "100", "110", false},
+		{model.TriggerPercent, "-10", "100", "89", true},
+		{model.TriggerPercent, "+10", "100", "89", false},
+		{model.TriggerPercent, "+10%", "100", "110", true},
+		// 旧值为 0 时任何变化都视为无穷大的幅度
+		{model.TriggerPercent, "10", "0", "1", true},
+		{model.TriggerPercent, "-10", "0", "-1", true},
+		{model.TriggerPercent, "10", "", "1", false},
+		{model.TriggerCrossBelow, "100", "100", "99", true},
+		{model.TriggerCrossBelow, "100", "99", "98", false},
+		{model.TriggerCrossBelow, "100", "99", "101", false},
+		{model.TriggerCrossAbove, "100", "100", "101", true},
+		{model.TriggerCrossAbove, "100", "101", "102", false},
+		{model.TriggerCross, "100", "101", "99", true},
+		{model.TriggerCross, "100", "99", "101", true},
+		{model.TriggerCross, "100", "Sold out", "99", false},
+		{model.TriggerContains, "out", "", "Sold out", true},
+		{model.TriggerNotContains, "out", "", "Sold out", false},
+		{model.TriggerRegex, `^\$\d+$`, "", "$12", true},
+	}
+	for _, test := range tests {
+		rule := model.TriggerRule{Name: "r1", Op: test.op, Value: test.value}
+		got, err := evaluateTriggerRule(rule, test.oldValue, test.newValue, "")
+		if err != nil {
+			t.Errorf("%s %s (%q -> %q) error = %v", test.op, test.value, test.oldValue, test.newValue, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s %s (%q -> %q) = %v, want %v", test.op, test.value, test.oldValue, test.newValue, got, test.want)
+		}
+	}
+}
+
+func TestParseTriggerExpression(t *testing.T) {
+	names := map[string]bool{"a": true, "b": true, "c": true}
+	tests := []struct {
+		expression string
+		results    map[string]bool
+		want       bool
+	}{
+		{"", map[string]bool{"a": true, "b": true}, true},
+		{"", map[string]bool{"a": true, "b": false}, false},
+		{"a || b", map[string]bool{"b": true}, true},
+		{"a && b", map[string]bool{"a": true}, false},
+		{"!a", map[string]bool{}, true},
+		{"!!a", map[string]bool{"a": true}, true},
+		// && 优先于 ||
+		{"a || b && c", map[string]bool{"a": true}, true},
+		{"(a || b) && c", map[string]bool{"a": true}, false},
+		{"a && !(b || c)", map[string]bool{"a": true, "c": true}, false},
+		{"a and not b", map[string]bool{"a": true}, true},
+		{"a OR b", map[string]bool{"b": true}, true},
+	}
+	for _, test := range tests {
+		expression, err := parseTriggerExpression(test.expression, names)
+		if err != nil {
+			t.Errorf("parseTriggerExpression(%q) error = %v", test.expression, err)
+			continue
+		}
+		if got := expression(test.results); got != test.want {
+			t.Errorf("%q with %v = %v, want %v", test.expression, test.results, got, test.want)
+		}
+	}
+	for _, expression := range []string{"a ||", "(a", "a)", "a b", "&& a", "()", "d", "a | b"} {
+		if _, err := parseTriggerExpression(expression, names); err == nil {
+			t.Errorf("parseTriggerExpression(%q) error = nil, want an error", expression)
+		}
+	}
+}
+
+func TestEvaluateTriggers(t *testing.T) {
+	job := model.Job{
+		TriggerRules:      `[{"name": "low", "op": "<", "value": "100"}, {"name": "soldOut", "op": "contains", "value": "Sold out"}]`,
+		TriggerExpression: "low || soldOut",
+	}
+	tests := []struct {
+		newValue string
+		want     bool
+	}{
+		{"$99", true},
+		{"$120", false},
+		{"Sold out", true},
+	}
+	for _, test := range tests {
+		got, err := EvaluateTriggers(job, "$110", test.newValue)
+		if err != nil {
+			t.Errorf("EvaluateTriggers(%q) error = %v", test.newValue, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("EvaluateTriggers(%q) = %v, want %v", test.newValue, got, test.want)
+		}
+	}
+	// 未设置规则时总是通知
+	if got, err := EvaluateTriggers(model.Job{}, "1", "2"); !got || err != nil {
+		t.Errorf("EvaluateTriggers() without rules = %v, %v, want true", got, err)
+	}
+	// 未命名的规则按顺序命名
+	job = model.Job{TriggerRules: `[{"op": ">", "value": "1"}, {"op": "<", "value": "10"}]`, TriggerExpression: "r1 && r2"}
+	if got, err := EvaluateTriggers(job, "", "5"); !got || err != nil {
+		t.Errorf("EvaluateTriggers() with unnamed rules = %v, %v, want true", got, err)
+	}
+}
+
+func TestValidateTriggers(t *testing.T) {
+	tests := []struct {
+		rules, expression string
+		valid             bool
+	}{
+		{`[{"name": "a", "op": "<", "value": "1.5"}]`, "a", true},
+		{`[{"name": "a", "op": "percent_change", "value": "-5%"}]`, "", true},
+		{`[{"name": "a", "op": "<", "value": "cheap"}]`, "", false},
+		{`[{"name": "a", "op": "~", "value": "1"}]`, "", false},
+		{`[{"name": "a", "op": "regex", "value": "("}]`, "", false},
+		{`[{"name": "a", "op": "<", "value": "1"}, {"name": "a", "op": ">", "value": "0"}]`, "", false},
+		{`[{"name": "a", "op": "<", "value": "1"}]`, "a && b", false},
+		{`not json`, "", false},
+	}
+	for _, test := range tests {
+		err := ValidateTriggers(model.Job{TriggerRules: test.rules, TriggerExpression: test.expression})
+		if (err == nil) != test.valid {
+			t.Errorf("ValidateTriggers(%s, %q) error = %v, want valid %v", test.rules, test.expression, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package util
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+)
+
+// XPathExtractor
+// XPath 提取器, 节点集取第一个节点的文本或属性值, 提取所有匹配时取所有节点, 也支持 string()、count() 等返回标量的表达式
+type XPathExtractor struct{}
+
+func (XPathExtractor) Extract(content []byte, pattern string) (string, error) {
+	targets, err := evaluateXPath(content, pattern, false)
+	if err != nil {
+		return "", err
+	}
+	return targets[0], nil
+}
+
+func (XPathExtractor) ExtractAll(content []byte, pattern string) ([]string, error) {
+	return evaluateXPath(content, pattern, true)
+}
+
+// evaluateXPath
+// 执行 XPath 表达式, all 为 false 时只取第一个节点
+func evaluateXPath(content []byte, pattern string, all bool) ([]string, error) {
+	expr, err := xpath.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	document, err := htmlquery.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	switch res := expr.Evaluate(htmlquery.CreateXPathNavigator(document)).(type) {
+	case *xpath.NodeIterator:
+		var targets []string
+		for res.MoveNext() {
+			targets = append(targets, strings.TrimSpace(res.Current().Value()))
+			if !all {
+				break
+			}
+		}
+		if len(targets) == 0 {
+			return nil, ErrTargetNotMatch
+		}
+		return targets, nil
+	case string:
+		return []string{res}, nil
+	case float64:
+		return []string{strconv.FormatFloat(res, 'f', -1, 64)}, nil
+	case bool:
+		return []string{strconv.FormatBool(res)}, nil
+	default:
+		return nil, ErrTargetNotMatch
+	}
+}